@@ -0,0 +1,58 @@
+// Embeds Lenslocked galleries in other sites. Each element like
+//
+//   <div data-lenslocked-gallery="https://lenslocked.example/galleries/6f1c2a9e-0d4b-4c3e-9a7f-2b1e5d8c4a10/my-trip/embed"
+//        data-layout="carousel" data-title="My trip"></div>
+//
+// is replaced by a frame showing the gallery, as a grid unless data-layout
+// is "carousel". The frame grows to fit the gallery, or keeps the height in
+// data-height when given.
+(function () {
+  let frames = [];
+
+  let embed = function (el) {
+    let src;
+    try {
+      src = new URL(el.getAttribute("data-lenslocked-gallery"), document.baseURI);
+    } catch (e) {
+      return;
+    }
+    let layout = el.getAttribute("data-layout");
+    if (layout) {
+      src.searchParams.set("layout", layout);
+    }
+    let frame = document.createElement("iframe");
+    frame.src = src.href;
+    frame.title = el.getAttribute("data-title") || "Lenslocked gallery";
+    frame.loading = "lazy";
+    frame.style.width = "100%";
+    frame.style.border = "0";
+    frame.style.height = (el.getAttribute("data-height") || "600") + "px";
+    frame.setAttribute("referrerpolicy", "origin");
+    frames.push({
+      frame: frame,
+      origin: src.origin,
+      fixed: el.hasAttribute("data-height"),
+    });
+    el.replaceWith(frame);
+  };
+
+  window.addEventListener("message", function (e) {
+    if (!e.data || e.data.type !== "lenslocked:resize") {
+      return;
+    }
+    for (let f of frames) {
+      if (f.frame.contentWindow === e.source && f.origin === e.origin && !f.fixed) {
+        f.frame.style.height = Math.ceil(e.data.height) + "px";
+      }
+    }
+  });
+
+  let run = function () {
+    document.querySelectorAll("[data-lenslocked-gallery]").forEach(embed);
+  };
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", run);
+  } else {
+    run();
+  }
+})();
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	err := godotenv.Load()
+	if err != nil {
+		panic(err)
+	}
+	db, err := models.Open(models.DefaultPostgresConfig())
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	galleryService := &models.GalleryService{DB: db}
+
+	switch os.Args[1] {
+	case "import":
+		importFiles(galleryService)
+	case "export":
+		exportFiles(galleryService)
+	default:
+		fmt.Printf("Invalid command: %v\n", os.Args[1])
+	}
+}
+
+/*
+	go run cmd/images/images.go import
+
+Run it once after migrating up past the images migration.
+*/
+func importFiles(galleryService *models.GalleryService) {
+	n, err := galleryService.ImportImageFiles()
+	if err != nil {
+		fmt.Printf("error importing: %v\n", err)
+	}
+	fmt.Printf("%d files imported\n", n)
+}
+
+/*
+	go run cmd/images/images.go export
+
+Run it before migrating down past the images migration.
+*/
+func exportFiles(galleryService *models.GalleryService) {
+	n, err := galleryService.ExportImageFiles()
+	if err != nil {
+		fmt.Printf("error exporting: %v\n", err)
+	}
+	fmt.Printf("%d files exported\n", n)
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"errors"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/csrf"
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/hkdf"
 )
 
 func loadEnvConfig() (router.Config, error) {
@@ -45,10 +47,89 @@ func loadEnvConfig() (router.Config, error) {
 	cfg.CSRF.Secure = os.Getenv("CSRF_SECURE") == "1"
 
 	cfg.Server.Address = ":" + os.Getenv("PORT_GO")
+	cfg.Server.BaseURL = strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if cfg.Server.BaseURL == "" {
+		cfg.Server.BaseURL = "http://localhost" + cfg.Server.Address
+	}
+	cfg.Server.TrustedProxies, err = parseNetworks(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.Images.SigningKey = os.Getenv("IMAGE_SIGNING_KEY")
+	if cfg.Images.SigningKey == "" {
+		cfg.Images.SigningKey, err = deriveKey(cfg.CSRF.Key, "image-urls")
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	cfg.Trash.Retention = models.DefaultTrashRetention
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Trash.Retention = time.Duration(n) * 24 * time.Hour
+	}
+
+	cfg.Comments.Key = os.Getenv("COMMENTS_KEY")
+	if cfg.Comments.Key == "" {
+		cfg.Comments.Key, err = deriveKey(cfg.CSRF.Key, "comment-ips")
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	cfg.Analytics.Key = os.Getenv("ANALYTICS_KEY")
+	if cfg.Analytics.Key == "" {
+		cfg.Analytics.Key, err = deriveKey(cfg.CSRF.Key, "analytics")
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	cfg.Robots.Disallow = controllers.DefaultRobotsDisallow
+	if disallow, ok := os.LookupEnv("ROBOTS_DISALLOW"); ok {
+		cfg.Robots.Disallow = strings.Fields(strings.ReplaceAll(disallow, ",", " "))
+	}
 
 	return cfg, nil
 }
 
+// deriveKey derives the key of a single use, named by label, from secret,
+// for keys that are not configured, so that no key is used for two things.
+func deriveKey(secret, label string) (string, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(label)), key)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// parseNetworks parses a list of networks in CIDR notation, or of single IP
+// addresses, separated by commas or spaces.
+func parseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, s := range strings.Fields(strings.ReplaceAll(list, ",", " ")) {
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
 func main() {
 	cfg, err := loadEnvConfig()
 	if err != nil {
@@ -82,6 +163,10 @@ func main() {
 		csrf.Path("/"),
 	)
 	// These middleware are used everywhere.
+	pmw := controllers.ProxyMiddleware{
+		TrustedProxies: cfg.Server.TrustedProxies,
+	}
+	r.Use(pmw.SetClientIP)
 	r.Use(csrfMw)
 	umw := controllers.UserMiddleware{
 		SessionService: sessionService,
@@ -89,6 +174,20 @@ func main() {
 	r.Use(umw.SetUser)
 	r.Use(LogMiddleware)
 
+	// Purge the trash in the background
+	go purgeTrash(&models.GalleryService{
+		DB:             db,
+		TrashRetention: cfg.Trash.Retention,
+	}, time.Hour)
+	// Hash the images uploaded before hashes were computed in the background
+	go hashImages(&models.GalleryService{
+		DB: db,
+	}, time.Hour)
+	// Add up the views of galleries in the background
+	go aggregateViews(&models.AnalyticsService{
+		DB: db,
+	}, time.Hour)
+
 	router.Router(r, umw, cfg, db, sessionService)
 	fmt.Printf("Starting the server on :%s...", cfg.Server.Address)
 	err = http.ListenAndServe(cfg.Server.Address, r)
@@ -100,7 +199,7 @@ func main() {
 func LogMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		ip, err := getIP(r)
+		ip, err := controllers.ClientIP(r)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -111,32 +210,50 @@ func LogMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// getIP returns the ip address from the http request
-func getIP(r *http.Request) (string, error) {
-	ips := r.Header.Get("X-Forwarded-For")
-	splitIps := strings.Split(ips, ",")
-
-	if len(splitIps) > 0 {
-		// get last IP in list since ELB prepends other user defined IPs, meaning the last one is the actual client IP.
-		netIP := net.ParseIP(splitIps[len(splitIps)-1])
-		if netIP != nil {
-			return netIP.String(), nil
+// purgeTrash deletes expired galleries and images from the trash right away
+// and then at every interval.
+func purgeTrash(galleryService *models.GalleryService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := galleryService.PurgeExpired()
+		if err != nil {
+			log.Printf("Purge trash: %v", err)
+		} else if n > 0 {
+			log.Printf("Purge trash: %d items deleted", n)
 		}
+		<-ticker.C
 	}
+}
 
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return "", err
+// hashImages computes the perceptual hashes of the images missing one right
+// away and then at every interval.
+func hashImages(galleryService *models.GalleryService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := galleryService.HashImages()
+		if err != nil {
+			log.Printf("Hash images: %v", err)
+		} else if n > 0 {
+			log.Printf("Hash images: %d images hashed", n)
+		}
+		<-ticker.C
 	}
+}
 
-	netIP := net.ParseIP(ip)
-	if netIP != nil {
-		ip := netIP.String()
-		if ip == "::1" {
-			return "127.0.0.1", nil
+// aggregateViews adds up the views of galleries of the past days right away
+// and then at every interval.
+func aggregateViews(analyticsService *models.AnalyticsService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := analyticsService.Aggregate()
+		if err != nil {
+			log.Printf("Aggregate views: %v", err)
+		} else if n > 0 {
+			log.Printf("Aggregate views: %d gallery days updated", n)
 		}
-		return ip, nil
+		<-ticker.C
 	}
-
-	return "", errors.New("IP not found")
 }
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/context"
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type Collections struct {
+	Templates struct {
+		Index Template
+	}
+	CollectionService *models.CollectionService
+}
+
+// CollectionOption is a collection as listed in forms, nested collections
+// being indented under their parent.
+type CollectionOption struct {
+	ID        uuid.UUID
+	ParentID  uuid.NullUUID
+	Title     string
+	Depth     int
+	Galleries int
+	Selected  bool
+}
+
+// Indent returns the prefix showing how deep the collection is nested.
+func (option CollectionOption) Indent() string {
+	return strings.Repeat("— ", option.Depth)
+}
+
+func collectionOptions(collections []models.Collection, selected ...uuid.UUID) []CollectionOption {
+	var options []CollectionOption
+	for _, collection := range models.Tree(collections) {
+		option := CollectionOption{
+			ID:        collection.ID,
+			ParentID:  collection.ParentID,
+			Title:     collection.Title,
+			Depth:     collection.Depth,
+			Galleries: collection.Galleries,
+		}
+		for _, id := range selected {
+			if id == collection.ID {
+				option.Selected = true
+			}
+		}
+		options = append(options, option)
+	}
+	return options
+}
+
+type collectionsData struct {
+	Collections []CollectionOption
+	Title       string
+	ParentID    string
+}
+
+func (c Collections) render(w http.ResponseWriter, r *http.Request, data collectionsData, errs ...error) {
+	collections, err := c.CollectionService.ByUserID(context.User(r.Context()).ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	data.Collections = collectionOptions(collections)
+	c.Templates.Index.Execute(w, r, data, errs...)
+}
+
+// Index lists the collections of the user, with forms to manage them.
+func (c Collections) Index(w http.ResponseWriter, r *http.Request) {
+	c.render(w, r, collectionsData{})
+}
+
+func (c Collections) Create(w http.ResponseWriter, r *http.Request) {
+	data := collectionsData{
+		Title:    r.FormValue("title"),
+		ParentID: r.FormValue("parent_id"),
+	}
+	parentID, err := parseOptionalUUID(data.ParentID)
+	if err != nil {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	_, err = c.CollectionService.Create(context.User(r.Context()).ID, parentID, data.Title)
+	if err != nil {
+		c.handleError(w, r, data, err)
+		return
+	}
+	http.Redirect(w, r, "/collections", http.StatusFound)
+}
+
+// Update renames a collection and moves it under the "parent_id" form value,
+// or to the top level when it is empty.
+func (c Collections) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	collection := models.Collection{
+		ID:     id,
+		UserID: context.User(r.Context()).ID,
+		Title:  r.FormValue("title"),
+	}
+	collection.ParentID, err = parseOptionalUUID(r.FormValue("parent_id"))
+	if err != nil {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	err = c.CollectionService.Update(&collection)
+	if err != nil {
+		c.handleError(w, r, collectionsData{}, err)
+		return
+	}
+	http.Redirect(w, r, "/collections", http.StatusFound)
+}
+
+func (c Collections) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	err = c.CollectionService.Delete(context.User(r.Context()).ID, id)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/collections", http.StatusFound)
+}
+
+// handleError shows errors above the collections, unless the collection
+// could not be found.
+func (c Collections) handleError(w http.ResponseWriter, r *http.Request, data collectionsData, err error) {
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	c.render(w, r, data, err)
+}
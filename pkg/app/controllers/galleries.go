@@ -4,9 +4,13 @@ import (
 	b64 "encoding/base64"
 	"errors"
 	"fmt"
+	"io/fs"
+	"mime"
 	"net/http"
 	"net/url"
-	"path/filepath"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/AguilaMike/lenslocked/pkg/app/context"
 	"github.com/AguilaMike/lenslocked/pkg/app/models"
@@ -17,43 +21,233 @@ import (
 
 type Galleries struct {
 	Templates struct {
-		Show  Template
-		New   Template
-		Edit  Template
-		Index Template
+		Show       Template
+		New        Template
+		Edit       Template
+		Index      Template
+		Profile    Template
+		Invitation Template
+		Selections Template
+		Comments   Template
+		Search     Template
+		Transfer   Template
+		Duplicates Template
+		Image      Template
+		Embed      Template
 	}
-	GalleryService *models.GalleryService
+	GalleryService    *models.GalleryService
+	UserService       *models.UserService
+	ShareLinkService  *models.ShareLinkService
+	MemberService     *models.GalleryMemberService
+	OwnershipService  *models.OwnershipTransferService
+	ProofingService   *models.ProofingService
+	CommentService    *models.CommentService
+	TagService        *models.TagService
+	CollectionService *models.CollectionService
+	SearchService     *models.SearchService
+	WatermarkService  *models.WatermarkService
+	EmbedService      *models.EmbedService
+	AnalyticsService  *models.AnalyticsService
+	EmailService      *models.EmailService
+	ImageURLs         ImageURLSigner
+	// BaseURL is used to build the absolute links sent by email.
+	BaseURL string
 }
 
 type GalleryDTO struct {
 	ID     uuid.UUID `form:"id"`
 	UserID uuid.UUID
-	Title  string  `form:"title"`
-	Public bool    `form:"public"`
-	ID64   string  `form:"id64"`
+	Title  string `form:"title"`
+	Public bool   `form:"public"`
+	// Path is the path of the page of the gallery, which the paths of its
+	// other pages start with.
+	Path   string
 	Images []Image `form:"images"`
+
+	AllowDownload bool `form:"allow_download"`
+	// NoIndex keeps a public gallery out of search engines.
+	NoIndex bool `form:"noindex"`
+	// CanDownload is set when the current visitor may download the gallery.
+	CanDownload bool
+	// Skipped lists uploaded files that were already in the gallery.
+	Skipped []string
+	// Renamed lists the new names of images copied or moved into the
+	// gallery whose name was taken.
+	Renamed []string
+	// TransferTargets are the other galleries the user can copy or move
+	// images to, and MergeSources the ones they can merge into this one.
+	TransferTargets []GalleryOption
+	MergeSources    []GalleryOption
+	// ThumbnailURL points to the cover image, or is empty for galleries
+	// without images.
+	ThumbnailURL string
+	OwnerID      uuid.UUID
+	// ShareLink is set when the gallery is being viewed through a share link.
+	ShareLink *models.ShareLink
+	// ShareLinks are the links the owner created for the gallery.
+	ShareLinks []ShareLink
+	// Role is the role of the current user in the gallery, if any.
+	Role    models.GalleryRole
+	Members []GalleryMember
+	// PendingTransfer is the ownership transfer waiting for its recipient,
+	// only shown to the owner.
+	PendingTransfer *PendingTransfer
+
+	ProofingEnabled bool `form:"proofing_enabled"`
+	SelectionLimit  int  `form:"selection_limit"`
+	// Proofing is set on the show page when the visitor can pick images.
+	Proofing *Proofing
+
+	// Meta describes the page to link previews.
+	Meta *PageMeta
+	// Embed and Analytics are set on the edit page for the owner and
+	// co-owners.
+	Embed     *EmbedSettings
+	Analytics *GalleryAnalytics
+
+	CommentsEnabled bool `form:"comments_enabled"`
+	Comments        *CommentThread
+	// CommentPending is set after the visitor posted a comment that waits
+	// for moderation.
+	CommentPending  bool
+	PendingComments int
+
+	Tags []string `form:"tags"`
+	// Collections are the collections of the owner, the ones the gallery is
+	// in being selected.
+	Collections []CollectionOption
+}
+
+// ImageCrop is a crop as shown in forms, in percent of the width and height
+// of the image.
+type ImageCrop struct {
+	Left, Top, Width, Height float64
+}
+
+func imageCrop(edit models.ImageEdit) ImageCrop {
+	crop := edit.Crop
+	if crop.Empty() {
+		return ImageCrop{Width: 100, Height: 100}
+	}
+	percent := func(v int) float64 {
+		return float64(v) * 100 / models.CropScale
+	}
+	return ImageCrop{
+		Left:   percent(crop.Min.X),
+		Top:    percent(crop.Min.Y),
+		Width:  percent(crop.Dx()),
+		Height: percent(crop.Dy()),
+	}
+}
+
+// TagList returns the tags of the gallery as they are typed in forms.
+func (g GalleryDTO) TagList() string {
+	return strings.Join(g.Tags, ", ")
+}
+
+// ShareQuery returns the query string that keeps the visitor on the share
+// link they came from, or an empty string.
+func (g GalleryDTO) ShareQuery() string {
+	if g.ShareLink == nil {
+		return ""
+	}
+	return "?" + url.Values{"share": {g.ShareLink.Token}}.Encode()
+}
+
+// Can reports whether the current user has at least the given role.
+func (g GalleryDTO) Can(role models.GalleryRole) bool {
+	return g.Role.Can(role)
 }
 
 type Image struct {
-	GalleryID       string
-	Filename        string
-	FilenameEscaped string
+	ID          uuid.UUID
+	GalleryID   string
+	GalleryPath string
+	Filename    string
+	Caption     string
+	AltText     string
+	IsCover     bool
+	URL         string
+	// Page is the viewer page of the image, only set on the show page and
+	// in embedded galleries.
+	Page string
+	// Edited is set when the image was rotated, flipped or cropped, and Crop
+	// is the part of it that is kept, in percent.
+	Edited bool
+	Crop   ImageCrop
+	// Picked and Note describe the pick of the current visitor, if any.
+	Picked bool
+	Note   string
+	// Comments is only set on the show page.
+	Comments *CommentThread
+	Tags     []string
 }
 
-func (g *GalleryDTO) IDEncode() string {
-	g.ID64 = b64.StdEncoding.EncodeToString([]byte(g.ID.String()))
-	return g.ID64
+// TagList returns the tags of the image as they are typed in forms.
+func (i Image) TagList() string {
+	return strings.Join(i.Tags, ", ")
 }
 
-func (g *GalleryDTO) IDDecodeFromBase64String(id string) (uuid.UUID, error) {
-	decodeID, _ := b64.StdEncoding.DecodeString(id)
-	return g.IDDecodeFromString(string(decodeID))
+// visitorWatermark returns the watermark of ownerID that visitors see, or nil
+// when the page shows clean images.
+func (g Galleries) visitorWatermark(ownerID uuid.UUID, clean bool) (*models.Watermark, error) {
+	if clean {
+		return nil, nil
+	}
+	return g.WatermarkService.ByUserID(ownerID)
 }
 
-func (g *GalleryDTO) IDDecodeFromString(id string) (uuid.UUID, error) {
-	var err error
-	g.ID, err = uuid.Parse(id)
-	return g.ID, err
+// imageURL returns the URL of an image of the gallery, marked with wm or
+// clean when wm is nil. The URL changes whenever the image does.
+func (g Galleries) imageURL(gallery *models.Gallery, imageID uuid.UUID, version func(watermark string) string, wm *models.Watermark) string {
+	if wm == nil {
+		return g.ImageURLs.URL(galleryPath(gallery), gallery.ID, imageID, version(""), true)
+	}
+	return g.ImageURLs.URL(galleryPath(gallery), gallery.ID, imageID, version(wm.Version()), false)
+}
+
+// imageDTOs lists images of the gallery, marked with the watermark wm of the
+// owner. Clean image URLs, when wm is nil, are only for the owner and members
+// of the gallery.
+func (g Galleries) imageDTOs(gallery *models.Gallery, images []models.Image, wm *models.Watermark) []Image {
+	var result []Image
+	for _, image := range images {
+		altText := image.AltText
+		if altText == "" {
+			altText = image.Filename
+		}
+		result = append(result, Image{
+			ID:          image.ID,
+			GalleryID:   image.GalleryID,
+			GalleryPath: galleryPath(gallery),
+			Filename:    image.Filename,
+			Caption:     image.Caption,
+			AltText:     altText,
+			IsCover:     gallery.CoverImageID.Valid && gallery.CoverImageID.UUID == image.ID,
+			URL:         g.imageURL(gallery, image.ID, image.Version, wm),
+			Edited:      image.Edit.Edited(),
+			Crop:        imageCrop(image.Edit),
+		})
+	}
+	return result
+}
+
+// galleryDTO lists a gallery, its thumbnail being marked with wm as in
+// imageDTOs.
+func (g Galleries) galleryDTO(gallery models.Gallery, wm *models.Watermark) GalleryDTO {
+	item := GalleryDTO{
+		ID:            gallery.ID,
+		Path:          galleryPath(&gallery),
+		UserID:        gallery.UserID,
+		OwnerID:       gallery.UserID,
+		Title:         gallery.Title,
+		Public:        gallery.Public,
+		AllowDownload: gallery.AllowDownload,
+	}
+	if gallery.ThumbnailID.Valid {
+		item.ThumbnailURL = g.imageURL(&gallery, gallery.ThumbnailID.UUID, gallery.ThumbnailVersion, wm)
+	}
+	return item
 }
 
 func (g Galleries) New(w http.ResponseWriter, r *http.Request) {
@@ -67,27 +261,62 @@ func (g Galleries) Create(w http.ResponseWriter, r *http.Request) {
 	data.UserID = context.User(r.Context()).ID
 	data.Title = r.FormValue("title")
 	data.Public = utils.ConvertBoolCheckbox(r.FormValue("public"))
+	data.AllowDownload = utils.ConvertBoolCheckbox(r.FormValue("allow_download"))
 
-	gallery, err := g.GalleryService.Create(data.Title, data.UserID, data.Public)
+	gallery, err := g.GalleryService.Create(data.Title, data.UserID, data.Public, data.AllowDownload)
 	if err != nil {
 		g.Templates.New.Execute(w, r, data, err)
 		return
 	}
 	data.ID = gallery.ID
-	// editPath := fmt.Sprintf("/galleries/%s/edit", data.IDEncode())
+	// editPath := fmt.Sprintf("%s/edit", data.Path)
 	editPath := fmt.Sprintf("/galleries")
 	http.Redirect(w, r, editPath, http.StatusFound)
 }
 
-func userMustOwnGallery(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
-	data.UserID = context.User(r.Context()).ID
-	if data.UserID != gallery.UserID {
-		http.Error(w, "You are not authorized to edit this gallery", http.StatusForbidden)
-		return fmt.Errorf("user does not have access to this gallery")
+// galleryMember sets data.Role to the role of the signed in user in the
+// gallery, if any, so that later options can grant access based on it.
+func (g Galleries) galleryMember(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
+	user := context.User(r.Context())
+	if user == nil {
+		return nil
+	}
+	data.UserID = user.ID
+	if user.ID == gallery.UserID {
+		data.Role = models.RoleOwner
+		return nil
 	}
+	role, err := g.MemberService.Role(gallery.ID, user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return err
+	}
+	data.Role = role
 	return nil
 }
 
+// userMustHaveRole only lets through the owner and members whose role
+// includes the permissions of role.
+func (g Galleries) userMustHaveRole(role models.GalleryRole) galleryOpt {
+	return func(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
+		err := g.galleryMember(w, r, data, gallery)
+		if err != nil {
+			return err
+		}
+		if !data.Role.Can(role) {
+			// Private galleries are not found by those who cannot see them.
+			if data.Role == "" && !gallery.Public {
+				http.Error(w, "Gallery not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "You are not authorized to edit this gallery", http.StatusForbidden)
+			}
+			return fmt.Errorf("user does not have access to this gallery")
+		}
+		return nil
+	}
+}
+
 func userMustPrivateGallery(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
 	user := context.User(r.Context())
 	if user != nil && user.ID != uuid.Nil {
@@ -96,8 +325,10 @@ func userMustPrivateGallery(w http.ResponseWriter, r *http.Request, data *Galler
 		data.UserID = uuid.Nil
 	}
 
-	if data.UserID != gallery.UserID && !gallery.Public {
-		http.Error(w, "You are not authorized to see this gallery", http.StatusForbidden)
+	if data.UserID != gallery.UserID && !gallery.Public && data.ShareLink == nil && !data.Role.Can(models.RoleViewer) {
+		// Telling them apart from galleries that do not exist would confirm
+		// that the gallery is there.
+		http.Error(w, "Gallery not found", http.StatusNotFound)
 		return fmt.Errorf("user does not have access to this gallery")
 	}
 	return nil
@@ -105,115 +336,362 @@ func userMustPrivateGallery(w http.ResponseWriter, r *http.Request, data *Galler
 
 type galleryOpt func(http.ResponseWriter, *http.Request, *GalleryDTO, *models.Gallery) error
 
-func (g Galleries) validate(w http.ResponseWriter, r *http.Request, data *GalleryDTO, err error, opts ...galleryOpt) (*models.Gallery, bool) {
+// galleryPath returns the path of the page of a gallery: the ID of its owner
+// and its slug, which is only unique among the galleries of the owner.
+func galleryPath(gallery *models.Gallery) string {
+	return fmt.Sprintf("/galleries/%s/%s", gallery.UserID, gallery.Slug)
+}
+
+// galleryByParam finds the gallery named by the "owner" and "id" URL
+// parameters, the ID of its owner and its slug or one of its former slugs.
+// Links from before galleries had slugs, carrying the gallery ID either as is
+// or base64 encoded in place of the owner, keep working too. It also returns
+// the part of the request path that named the gallery.
+func (g Galleries) galleryByParam(r *http.Request) (*models.Gallery, string, error) {
+	owner, slug := chi.URLParam(r, "owner"), chi.URLParam(r, "id")
+	if userID, err := uuid.Parse(owner); err == nil && slug != "" {
+		gallery, err := g.GalleryService.BySlug(userID, slug)
+		if !errors.Is(err, models.ErrNotFound) {
+			return gallery, "/galleries/" + owner + "/" + slug, err
+		}
+	}
+	id, err := uuid.Parse(owner)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusNotFound)
-		return nil, false
+		decoded, _ := b64.StdEncoding.DecodeString(owner)
+		id, err = uuid.Parse(string(decoded))
+		if err != nil {
+			return nil, "", models.ErrNotFound
+		}
 	}
-	gallery, err := g.GalleryService.ByID(data.ID)
+	gallery, err := g.GalleryService.ByID(id)
+	return gallery, "/galleries/" + owner, err
+}
+
+// validate finds the gallery of the request and runs opts on it. Pages asked
+// for with anything but the current path of the gallery are redirected to
+// it, once opts let the visitor in, so that the path of a gallery is never
+// given to those who cannot see it.
+func (g Galleries) validate(w http.ResponseWriter, r *http.Request, data *GalleryDTO, opts ...galleryOpt) (*models.Gallery, bool) {
+	gallery, path, err := g.galleryByParam(r)
 	if err != nil {
 		if errors.Is(err, models.ErrNotFound) {
 			http.Error(w, "Gallery not found", http.StatusNotFound)
 			return nil, false
 		}
+		fmt.Println(err)
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return nil, false
 	}
+	if !g.check(w, r, data, gallery, opts...) {
+		return gallery, false
+	}
+	if path != data.Path && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		u := *r.URL
+		u.Path = data.Path + strings.TrimPrefix(u.Path, path)
+		u.RawPath = ""
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+		return nil, false
+	}
+	return gallery, true
+}
+
+// check runs opts on a gallery that was already found.
+func (g Galleries) check(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery, opts ...galleryOpt) bool {
+	data.ID = gallery.ID
+	data.Path = galleryPath(gallery)
 	for _, opt := range opts {
-		err = opt(w, r, data, gallery)
+		err := opt(w, r, data, gallery)
 		if err != nil {
-			return nil, false
+			return false
 		}
 	}
-	return gallery, true
+	return true
+}
+
+// visitorError reports errors caused by the visitor with their public
+// message, and everything else as a server error.
+func visitorError(w http.ResponseWriter, err error) {
+	var pubErr interface{ Public() string }
+	if errors.As(err, &pubErr) {
+		http.Error(w, pubErr.Public(), http.StatusBadRequest)
+		return
+	}
+	fmt.Println(err)
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
 }
 
 func (g Galleries) Edit(w http.ResponseWriter, r *http.Request) {
 	var data GalleryDTO
-	_, err := data.IDDecodeFromBase64String(chi.URLParam(r, "id"))
-	gallery, ok := g.validate(w, r, &data, err, userMustOwnGallery)
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleContributor))
 	if !ok {
 		return
 	}
 	data.Title = gallery.Title
 	data.Public = gallery.Public
+	data.AllowDownload = gallery.AllowDownload
+	data.NoIndex = gallery.NoIndex
+	data.ProofingEnabled = gallery.ProofingEnabled
+	data.SelectionLimit = gallery.SelectionLimit
+	data.CommentsEnabled = gallery.CommentsEnabled
+	data.Skipped = r.URL.Query()["skipped"]
+	data.Renamed = r.URL.Query()["renamed"]
 	images, err := g.GalleryService.Images(gallery.ID)
 	if err != nil {
 		fmt.Println(err)
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
-	for _, image := range images {
-		data.Images = append(data.Images, Image{
-			GalleryID:       image.GalleryID,
-			Filename:        image.Filename,
-			FilenameEscaped: url.PathEscape(image.Filename),
-		})
+	data.Images = g.imageDTOs(gallery, images, nil)
+	data.Tags, err = g.TagService.GalleryTags(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	imageTags, err := g.TagService.ImageTags(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	for i, image := range data.Images {
+		data.Images[i].Tags = imageTags[image.ID]
+	}
+	if data.Can(models.RoleEditor) {
+		err = g.transferOptions(&data, gallery)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+	}
+	// Collections organise the galleries of the owner, members cannot see
+	// them.
+	if data.Role == models.RoleOwner {
+		collections, err := g.CollectionService.ByUserID(gallery.UserID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		selected, err := g.CollectionService.ByGalleryID(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		data.Collections = collectionOptions(collections, selected...)
+		data.PendingTransfer, err = g.pendingTransfer(gallery)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+	}
+	if data.Can(models.RoleCoOwner) {
+		links, err := g.ShareLinkService.ByGalleryID(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		data.ShareLinks = shareLinkDTOs(data.Path, links)
+		members, err := g.MemberService.ByGalleryID(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		data.Members = galleryMemberDTOs(members)
+		data.Embed, err = g.embedSettings(gallery)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		data.Analytics, err = g.analytics(gallery)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		data.PendingComments, err = g.CommentService.Pending(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
 	}
 	g.Templates.Edit.Execute(w, r, data)
 }
 
 func (g Galleries) Update(w http.ResponseWriter, r *http.Request) {
 	var data GalleryDTO
-	_, err := data.IDDecodeFromString(chi.URLParam(r, "id"))
-	gallery, ok := g.validate(w, r, &data, err, userMustOwnGallery)
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
 	if !ok {
 		return
 	}
 	r.ParseForm()
 	data.Title = r.FormValue("title")
 	data.Public = utils.ConvertBoolCheckbox(r.FormValue("public"))
-	if err != nil {
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
-		return
+	data.AllowDownload = utils.ConvertBoolCheckbox(r.FormValue("allow_download"))
+	data.NoIndex = utils.ConvertBoolCheckbox(r.FormValue("noindex"))
+	data.ProofingEnabled = utils.ConvertBoolCheckbox(r.FormValue("proofing_enabled"))
+	var err error
+	data.SelectionLimit, err = strconv.Atoi(r.FormValue("selection_limit"))
+	if err != nil || data.SelectionLimit < 0 {
+		data.SelectionLimit = 0
 	}
+	data.CommentsEnabled = utils.ConvertBoolCheckbox(r.FormValue("comments_enabled"))
 	gallery.Title = data.Title
 	gallery.Public = data.Public
+	gallery.AllowDownload = data.AllowDownload
+	gallery.NoIndex = data.NoIndex
+	gallery.ProofingEnabled = data.ProofingEnabled
+	gallery.SelectionLimit = data.SelectionLimit
+	gallery.CommentsEnabled = data.CommentsEnabled
 	err = g.GalleryService.Update(gallery)
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
-	// editPath := fmt.Sprintf("/galleries/%s/edit", data.IDEncode())
+	data.Tags = models.ParseTags(r.FormValue("tags"))
+	err = g.TagService.SetGalleryTags(gallery.UserID, gallery.ID, data.Tags)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if data.Role == models.RoleOwner {
+		var collectionIDs []uuid.UUID
+		for _, value := range r.Form["collection"] {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				continue
+			}
+			collectionIDs = append(collectionIDs, id)
+		}
+		err = g.CollectionService.SetGalleryCollections(gallery.UserID, gallery.ID, collectionIDs)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+	}
+	// editPath := fmt.Sprintf("%s/edit", data.Path)
 	editPath := fmt.Sprintf("/galleries")
 	http.Redirect(w, r, editPath, http.StatusFound)
 }
 
+// Index lists a page of the galleries of the user. The "tag", "collection"
+// and "sort" query values filter and order the list, and the "cursor" query
+// value picks the page.
 func (g Galleries) Index(w http.ResponseWriter, r *http.Request) {
 	var data struct {
 		Galleries []GalleryDTO
+		// Shared are the galleries of other users the user is a member of.
+		Shared []GalleryDTO
+		// Filtered is set when only some of the galleries are listed.
+		Filtered    bool
+		Tag         string
+		Sort        models.GallerySort
+		Sorts       []models.GallerySort
+		Tags        []models.Tag
+		Collections []CollectionOption
+		// Search is set when the user searched their galleries with the "q"
+		// query value, in which case only the results are listed.
+		Search *SearchPage
+		Pagination
 	}
 
 	user := context.User(r.Context()).ID
-	galleries, err := g.GalleryService.ByUserID(user)
+	query := r.URL.Query()
+	if strings.TrimSpace(query.Get("q")) != "" {
+		search, err := g.search(r, uuid.NullUUID{UUID: user, Valid: true})
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		data.Search = search
+		g.Templates.Index.Execute(w, r, data)
+		return
+	}
+	filter := models.GalleryFilter{
+		Tag:  strings.TrimSpace(query.Get("tag")),
+		Sort: models.ParseGallerySort(query.Get("sort")),
+	}
+	filter.CollectionID, _ = parseOptionalUUID(query.Get("collection"))
+	data.Filtered = filter.Tag != "" || filter.CollectionID.Valid
+	data.Tag = filter.Tag
+	data.Sort = filter.Sort
+	data.Sorts = models.GallerySorts
+	page := pageRequest(r)
+	galleries, info, err := g.GalleryService.ByUserID(user, filter, page)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	tags, err := g.TagService.GalleryTagsByUserID(user)
 	if err != nil {
 		fmt.Println(err)
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
 	for _, gallery := range galleries {
-		item := GalleryDTO{
-			ID:     gallery.ID,
-			UserID: user,
-			Title:  gallery.Title,
-			Public: gallery.Public,
-		}
-		item.IDEncode()
+		item := g.galleryDTO(gallery, nil)
+		item.Tags = tags[gallery.ID]
 		data.Galleries = append(data.Galleries, item)
 	}
+	data.Pagination = pagination(r, info)
+	data.Tags, err = g.TagService.ByUserID(user)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	collections, err := g.CollectionService.ByUserID(user)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	data.Collections = collectionOptions(collections, filter.CollectionID.UUID)
+	// Shared galleries are only listed along with the first page.
+	if page.Cursor == nil {
+		shared, err := g.GalleryService.ByMemberID(user)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		for _, gallery := range shared {
+			data.Shared = append(data.Shared, g.galleryDTO(gallery, nil))
+		}
+	}
 	// TODO: Lookup the galleries we are going to render
 	g.Templates.Index.Execute(w, r, data)
 }
 
 func (g Galleries) Show(w http.ResponseWriter, r *http.Request) {
 	var data GalleryDTO
-	_, err := data.IDDecodeFromBase64String(chi.URLParam(r, "id"))
-	gallery, ok := g.validate(w, r, &data, err, userMustPrivateGallery)
+	gallery, ok := g.validate(w, r, &data, g.galleryMember, g.shareLink, userMustPrivateGallery)
 	if !ok {
 		return
 	}
 	data.ID = gallery.ID
+	data.OwnerID = gallery.UserID
 	data.Title = gallery.Title
+	data.Public = gallery.Public
+	data.AllowDownload = gallery.AllowDownload
+	data.CanDownload = canDownload(data, gallery)
+	if data.ShareLink != nil {
+		err := g.ShareLinkService.CountView(data.ShareLink.ID)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
 
 	images, err := g.GalleryService.Images(gallery.ID)
 	if err != nil {
@@ -221,12 +699,51 @@ func (g Galleries) Show(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
-	for _, image := range images {
-		data.Images = append(data.Images, Image{
-			GalleryID:       image.GalleryID,
-			Filename:        image.Filename,
-			FilenameEscaped: url.PathEscape(image.Filename),
-		})
+	wm, err := g.visitorWatermark(gallery.UserID, data.Role != "")
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	data.Images = g.imageDTOs(gallery, images, wm)
+	for i := range data.Images {
+		data.Images[i].Page = imagePagePath(data, i+1, 0)
+	}
+	data.Meta = g.galleryMeta(gallery, len(images), wm)
+	setRobotsTag(w, gallery)
+	// Members do not count as visitors.
+	if data.Role == "" {
+		g.recordView(r, gallery.ID, uuid.NullUUID{}, models.ViewGallery)
+	}
+	// Members review images from the edit page, proofing is for clients.
+	if gallery.ProofingEnabled && !data.Can(models.RoleViewer) {
+		selection, err := g.selection(r, gallery)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		data.Proofing = proofingDTO(gallery, selection)
+		for i, image := range data.Images {
+			if pick, ok := selection.Pick(image.ID); ok {
+				data.Images[i].Picked = true
+				data.Images[i].Note = pick.Note
+			}
+		}
+	}
+	comments, err := g.CommentService.ByGalleryID(gallery.ID, false)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	g.commentThreads(&data, gallery, comments)
+	data.CommentPending = r.URL.Query().Get("comment") == "pending"
+	if data.Can(models.RoleCoOwner) {
+		data.PendingComments, err = g.CommentService.Pending(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+		}
 	}
 
 	g.Templates.Show.Execute(w, r, data)
@@ -234,12 +751,11 @@ func (g Galleries) Show(w http.ResponseWriter, r *http.Request) {
 
 func (g Galleries) Delete(w http.ResponseWriter, r *http.Request) {
 	var data GalleryDTO
-	_, err := data.IDDecodeFromBase64String(chi.URLParam(r, "id"))
-	gallery, ok := g.validate(w, r, &data, err, userMustOwnGallery)
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleCoOwner))
 	if !ok {
 		return
 	}
-	err = g.GalleryService.Delete(gallery.ID)
+	err := g.GalleryService.Delete(gallery.ID)
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
@@ -247,21 +763,47 @@ func (g Galleries) Delete(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/galleries", http.StatusFound)
 }
 
-func (g Galleries) filename(w http.ResponseWriter, r *http.Request) string {
-	filename := chi.URLParam(r, "filename")
-	filename = filepath.Base(filename)
-	return filename
+func (g Galleries) imageID(r *http.Request) (uuid.UUID, error) {
+	return uuid.Parse(chi.URLParam(r, "imageID"))
 }
 
+// Image serves an image file. Requests carrying a valid signature (see
+// ImageURLSigner) are served without further checks; every other request
+// needs the same access to the gallery as the show page. Visitors get the
+// image with the watermark of the gallery owner, while the owner and members
+// get it clean.
+//
+// The ETag of the image is its version, which changes whenever the image is
+// edited or marked with another watermark. URLs carrying the current version
+// in their "v" query value are cached for good, other URLs are revalidated.
+// Range requests are supported.
 func (g Galleries) Image(w http.ResponseWriter, r *http.Request) {
-	filename := g.filename(w, r)
 	var data GalleryDTO
-	_, err := data.IDDecodeFromString(chi.URLParam(r, "id"))
+	gallery, _, err := g.galleryByParam(r)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusNotFound)
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Gallery not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
-	image, err := g.GalleryService.Image(data.ID, filename)
+	imageID, err := g.imageID(r)
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	expires, signed := g.ImageURLs.Verify(gallery.ID, imageID, r.URL.Query())
+	clean := signed && r.URL.Query().Get("clean") == "1"
+	if !signed {
+		ok := g.check(w, r, &data, gallery, g.galleryMember, g.shareLink, userMustPrivateGallery)
+		if !ok {
+			return
+		}
+		clean = data.Role != ""
+	}
+	image, err := g.GalleryService.Image(gallery.ID, imageID)
 	if err != nil {
 		if errors.Is(err, models.ErrNotFound) {
 			http.Error(w, "Image not found", http.StatusNotFound)
@@ -271,39 +813,104 @@ func (g Galleries) Image(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
-	http.ServeFile(w, r, image.Path)
+	wm, err := g.visitorWatermark(gallery.UserID, clean)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	var version string
+	if wm == nil {
+		version = image.Version("")
+	} else {
+		version = image.Version(wm.Version())
+	}
+	etag := `"` + version + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", imageCacheControl(expires, signed, r.URL.Query().Get("v") == version))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": image.Filename}))
+	setRobotsTag(w, gallery)
+	// Answered before the image is rendered.
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	var path string
+	if wm == nil {
+		path, err = g.GalleryService.EditedImagePath(image)
+	} else {
+		path, err = g.WatermarkService.Apply(wm, image)
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	// ServeContent takes care of conditional and range requests, and of the
+	// content type, from the extension of the name.
+	http.ServeContent(w, r, image.Filename, stat.ModTime(), file)
 }
 
 func (g Galleries) DeleteImage(w http.ResponseWriter, r *http.Request) {
-	filename := g.filename(w, r)
 	var data GalleryDTO
-	_, err := data.IDDecodeFromString(chi.URLParam(r, "id"))
-	gallery, ok := g.validate(w, r, &data, err, userMustOwnGallery)
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
 	if !ok {
 		return
 	}
-	err = g.GalleryService.DeleteImage(gallery.ID, filename)
+	imageID, err := g.imageID(r)
 	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	err = g.GalleryService.DeleteImage(gallery.ID, imageID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
-	editPath := fmt.Sprintf("/galleries/%s/edit", data.IDEncode())
+	editPath := fmt.Sprintf("%s/edit", data.Path)
 	http.Redirect(w, r, editPath, http.StatusFound)
 }
 
 func (g Galleries) UploadImage(w http.ResponseWriter, r *http.Request) {
 	var data GalleryDTO
-	_, err := data.IDDecodeFromString(chi.URLParam(r, "id"))
-	gallery, ok := g.validate(w, r, &data, err, userMustOwnGallery)
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleContributor))
 	if !ok {
 		return
 	}
-	err = r.ParseMultipartForm(5 << 20) // 5mb
+	err := r.ParseMultipartForm(5 << 20) // 5mb
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		return
 	}
 
+	// Files that are already in the gallery are skipped and reported back to
+	// the edit page rather than failing the whole upload.
+	skipped := url.Values{}
 	fileHeaders := r.MultipartForm.File["images"]
 	for _, fileHeader := range fileHeaders {
 		file, err := fileHeader.Open()
@@ -314,8 +921,12 @@ func (g Galleries) UploadImage(w http.ResponseWriter, r *http.Request) {
 		defer file.Close()
 		//fmt.Printf("Attempting to upload %v for gallery %s.\n", fileHeader.Filename, gallery.ID.String())
 		// io.Copy(w, file)
-		err = g.GalleryService.CreateImage(gallery.ID, fileHeader.Filename, file)
+		_, err = g.GalleryService.CreateImage(gallery.ID, fileHeader.Filename, file)
 		if err != nil {
+			if errors.Is(err, models.ErrDuplicateImage) {
+				skipped.Add("skipped", fileHeader.Filename)
+				continue
+			}
 			var fileErr models.FileError
 			if errors.As(err, &fileErr) {
 				msg := fmt.Sprintf("%v has an invalid content type or extension. Only png, gif, and jpg files can be uploaded.", fileHeader.Filename)
@@ -327,6 +938,144 @@ func (g Galleries) UploadImage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	editPath := fmt.Sprintf("/galleries/%s/edit", data.IDEncode())
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	if len(skipped) > 0 {
+		editPath += "?" + skipped.Encode()
+	}
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) UpdateImage(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	imageID, err := g.imageID(r)
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	image, err := g.GalleryService.Image(gallery.ID, imageID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	image.Caption = strings.TrimSpace(r.FormValue("caption"))
+	image.AltText = strings.TrimSpace(r.FormValue("alt_text"))
+	err = g.GalleryService.UpdateImage(&image)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	err = g.TagService.SetImageTags(gallery.UserID, image.ID, models.ParseTags(r.FormValue("tags")))
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+// ReorderImages expects the "order" form value to hold the image IDs of the
+// gallery, comma separated, in their new order.
+func (g Galleries) ReorderImages(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	var imageIDs []uuid.UUID
+	for _, value := range strings.Split(r.FormValue("order"), ",") {
+		imageID, err := uuid.Parse(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		imageIDs = append(imageIDs, imageID)
+	}
+	err := g.GalleryService.ReorderImages(gallery.ID, imageIDs)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
 	http.Redirect(w, r, editPath, http.StatusFound)
 }
+
+// SetCover uses the "image_id" form value as the gallery cover. An empty
+// value resets the cover to the first image.
+func (g Galleries) SetCover(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	imageID := uuid.Nil
+	var err error
+	if value := r.FormValue("image_id"); value != "" {
+		imageID, err = uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+	}
+	err = g.GalleryService.SetCover(gallery.ID, imageID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+// Profile lists a page of the public galleries of a user.
+func (g Galleries) Profile(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		UserID    uuid.UUID
+		Galleries []GalleryDTO
+		Meta      *PageMeta
+		Pagination
+	}
+	var err error
+	data.UserID, err = uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	galleries, info, err := g.GalleryService.PublicByUserID(data.UserID, pageRequest(r))
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	wm, err := g.visitorWatermark(data.UserID, false)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	for _, gallery := range galleries {
+		data.Galleries = append(data.Galleries, g.galleryDTO(gallery, wm))
+	}
+	data.Pagination = pagination(r, info)
+	data.Meta = &PageMeta{
+		Type:        "profile",
+		Title:       "Public Galleries",
+		Description: fmt.Sprintf("Galleries published by a %s.", photographerName),
+		URL:         fmt.Sprintf("%s/profiles/%s", g.BaseURL, data.UserID),
+	}
+	g.Templates.Profile.Execute(w, r, data)
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/google/uuid"
+)
+
+// analyticsDays is the number of days covered by the charts of the edit
+// page, today included.
+const analyticsDays = 30
+
+// GalleryAnalytics are the views of a gallery over the last days, only shown
+// to its owner and co-owners.
+type GalleryAnalytics struct {
+	Days   int
+	Charts []AnalyticsChart
+}
+
+// AnalyticsChart is a bar chart of one count, with a bar per day, and the
+// total of the days.
+type AnalyticsChart struct {
+	Title string
+	Total int
+	Bars  []AnalyticsBar
+}
+
+// AnalyticsBar is the count of one day.
+type AnalyticsBar struct {
+	Date  string
+	Value int
+	// Height is the height of the bar, in percent of the highest one.
+	Height int
+}
+
+// recordView records a view by the visitor of r. Errors are only logged, as
+// they must not keep the visitor from the gallery.
+func (g Galleries) recordView(r *http.Request, galleryID uuid.UUID, imageID uuid.NullUUID, kind models.ViewKind) {
+	ip, err := ClientIP(r)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = g.AnalyticsService.Record(galleryID, imageID, kind, ip)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// analyticsChart charts the count picked by value on each day of days.
+func analyticsChart(title string, days []models.ViewStats, value func(models.ViewStats) int) AnalyticsChart {
+	chart := AnalyticsChart{Title: title}
+	highest := 0
+	for _, day := range days {
+		chart.Total += value(day)
+		highest = max(highest, value(day))
+	}
+	for _, day := range days {
+		bar := AnalyticsBar{
+			Date:  time.Unix(day.Day, 0).UTC().Format("Jan 2"),
+			Value: value(day),
+		}
+		if highest > 0 {
+			bar.Height = bar.Value * 100 / highest
+		}
+		chart.Bars = append(chart.Bars, bar)
+	}
+	return chart
+}
+
+// analytics reads the views of a gallery over the last analyticsDays days.
+func (g Galleries) analytics(gallery *models.Gallery) (*GalleryAnalytics, error) {
+	start := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-analyticsDays)
+	stats, err := g.AnalyticsService.Daily(gallery.ID, start)
+	if err != nil {
+		return nil, err
+	}
+	byDay := make(map[int64]models.ViewStats, len(stats))
+	for _, day := range stats {
+		byDay[day.Day] = day
+	}
+	// Days without views are charted too.
+	days := make([]models.ViewStats, analyticsDays)
+	for i := range days {
+		day := start.AddDate(0, 0, i).Unix()
+		days[i] = byDay[day]
+		days[i].Day = day
+	}
+
+	analytics := &GalleryAnalytics{Days: analyticsDays}
+	analytics.Charts = []AnalyticsChart{
+		analyticsChart("Gallery views", days, func(s models.ViewStats) int { return s.GalleryViews }),
+		analyticsChart("Visitors", days, func(s models.ViewStats) int { return s.Visitors }),
+		analyticsChart("Image views", days, func(s models.ViewStats) int { return s.ImageViews }),
+		analyticsChart("Downloads", days, func(s models.ViewStats) int { return s.Downloads }),
+	}
+	return analytics, nil
+}
@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/context"
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Comment is an approved comment along with its approved replies.
+type Comment struct {
+	ID         uuid.UUID
+	AuthorName string
+	Guest      bool
+	Body       string
+	CreatedAt  string
+	Replies    []*Comment
+	// Thread is the thread the comment belongs to, so replies can be posted
+	// to it.
+	Thread *CommentThread
+}
+
+// CommentThread holds the comments of a gallery, or of one of its images.
+type CommentThread struct {
+	// Action is where new comments are posted to.
+	Action  string
+	ImageID uuid.NullUUID
+	// Open is set when new comments can be posted.
+	Open     bool
+	Comments []*Comment
+	Count    int
+}
+
+// CommentForm describes a form posting a comment, or a reply when ParentID
+// is set.
+type CommentForm struct {
+	Action   string
+	ImageID  uuid.NullUUID
+	ParentID uuid.NullUUID
+}
+
+func (thread *CommentThread) Form() CommentForm {
+	return CommentForm{
+		Action:  thread.Action,
+		ImageID: thread.ImageID,
+	}
+}
+
+func (comment *Comment) ReplyForm() CommentForm {
+	return CommentForm{
+		Action:   comment.Thread.Action,
+		ParentID: uuid.NullUUID{UUID: comment.ID, Valid: true},
+	}
+}
+
+// ModeratedComment is a comment as seen on the moderation page.
+type ModeratedComment struct {
+	ID            uuid.UUID
+	AuthorName    string
+	AuthorEmail   string
+	Guest         bool
+	Body          string
+	CreatedAt     string
+	Status        models.CommentStatus
+	ImageFilename string
+	Reply         bool
+}
+
+func formatCommentTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04")
+}
+
+// commentThreads sorts the approved comments of a gallery into the thread of
+// the gallery and the threads of its images.
+func (g Galleries) commentThreads(data *GalleryDTO, gallery *models.Gallery, comments []models.Comment) {
+	action := fmt.Sprintf("%s/comments%s", galleryPath(gallery), data.ShareQuery())
+	data.Comments = &CommentThread{
+		Action: action,
+		Open:   gallery.CommentsEnabled,
+	}
+	threads := map[uuid.UUID]*CommentThread{}
+	for i := range data.Images {
+		thread := &CommentThread{
+			Action:  action,
+			ImageID: uuid.NullUUID{UUID: data.Images[i].ID, Valid: true},
+			Open:    gallery.CommentsEnabled,
+		}
+		data.Images[i].Comments = thread
+		threads[data.Images[i].ID] = thread
+	}
+
+	byID := map[uuid.UUID]*Comment{}
+	for _, comment := range comments {
+		thread := data.Comments
+		if comment.ImageID.Valid {
+			thread = threads[comment.ImageID.UUID]
+		}
+		if thread == nil {
+			continue
+		}
+		item := &Comment{
+			ID:         comment.ID,
+			AuthorName: comment.AuthorName,
+			Guest:      !comment.UserID.Valid,
+			Body:       comment.Body,
+			CreatedAt:  formatCommentTime(comment.CreatedAt),
+			Thread:     thread,
+		}
+		if comment.ParentID.Valid {
+			// Replies to comments that are not visible are not shown either.
+			parent, ok := byID[comment.ParentID.UUID]
+			if !ok {
+				continue
+			}
+			parent.Replies = append(parent.Replies, item)
+		} else {
+			thread.Comments = append(thread.Comments, item)
+		}
+		byID[comment.ID] = item
+		thread.Count++
+	}
+}
+
+func galleryMustAllowComments(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
+	if !gallery.CommentsEnabled {
+		http.Error(w, "Comments are disabled for this gallery", http.StatusForbidden)
+		return fmt.Errorf("gallery does not allow comments")
+	}
+	return nil
+}
+
+func (g Galleries) commentRedirect(w http.ResponseWriter, r *http.Request, data GalleryDTO, pending bool, anchor string) {
+	query := url.Values{}
+	if data.ShareLink != nil {
+		query.Set("share", data.ShareLink.Token)
+	}
+	if pending {
+		query.Set("comment", "pending")
+	}
+	path := data.Path
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	http.Redirect(w, r, path+"#"+anchor, http.StatusFound)
+}
+
+func parseOptionalUUID(s string) (uuid.NullUUID, error) {
+	if s == "" {
+		return uuid.NullUUID{}, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: id, Valid: true}, nil
+}
+
+// CreateComment posts a comment on the gallery, on one of its images when
+// the "image_id" form value is set, or a reply to "parent_id".
+func (g Galleries) CreateComment(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.galleryMember, g.shareLink, userMustPrivateGallery, galleryMustAllowComments)
+	if !ok {
+		return
+	}
+	// People do not see the website field, bots fill it in.
+	if r.FormValue("website") != "" {
+		g.commentRedirect(w, r, data, true, "comments")
+		return
+	}
+	comment := models.Comment{
+		GalleryID:   gallery.ID,
+		AuthorName:  r.FormValue("name"),
+		AuthorEmail: r.FormValue("email"),
+		Body:        r.FormValue("body"),
+	}
+	comment.IP, _ = ClientIP(r)
+	if user := context.User(r.Context()); user != nil {
+		comment.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+		comment.AuthorEmail = user.Email
+		if strings.TrimSpace(comment.AuthorName) == "" {
+			comment.AuthorName, _, _ = strings.Cut(user.Email, "@")
+		}
+	}
+	var err error
+	comment.ImageID, err = parseOptionalUUID(r.FormValue("image_id"))
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	comment.ParentID, err = parseOptionalUUID(r.FormValue("parent_id"))
+	if err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	err = g.CommentService.Create(&comment, data.Role)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+		visitorError(w, err)
+		return
+	}
+	if data.UserID != gallery.UserID {
+		owner, err := g.UserService.ByID(gallery.UserID)
+		if err == nil {
+			moderateURL := fmt.Sprintf("%s%s/comments", g.BaseURL, data.Path)
+			err = g.EmailService.NewComment(owner.Email, gallery.Title, comment, moderateURL)
+		}
+		if err != nil {
+			// The comment is saved, so the visitor does not need to know.
+			fmt.Println(err)
+		}
+	}
+	pending := comment.Status == models.CommentPending
+	anchor := "comment-" + comment.ID.String()
+	if pending {
+		anchor = "comments"
+	}
+	g.commentRedirect(w, r, data, pending, anchor)
+}
+
+// Comments lists every comment of a gallery for moderation. The "status"
+// query value filters the list.
+func (g Galleries) Comments(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		GalleryDTO
+		Filter   string
+		Statuses []models.CommentStatus
+		List     []ModeratedComment
+	}
+	gallery, ok := g.validate(w, r, &data.GalleryDTO, g.userMustHaveRole(models.RoleCoOwner))
+	if !ok {
+		return
+	}
+	data.Title = gallery.Title
+	data.CommentsEnabled = gallery.CommentsEnabled
+	data.Statuses = []models.CommentStatus{models.CommentPending, models.CommentApproved, models.CommentHidden}
+	filter, err := models.ParseCommentStatus(r.URL.Query().Get("status"))
+	if err == nil {
+		data.Filter = string(filter)
+	}
+	comments, err := g.CommentService.ByGalleryID(gallery.ID, true)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	// Newest first, which is what moderators care about.
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := comments[i]
+		if data.Filter != "" && comment.Status != filter {
+			continue
+		}
+		data.List = append(data.List, ModeratedComment{
+			ID:            comment.ID,
+			AuthorName:    comment.AuthorName,
+			AuthorEmail:   comment.AuthorEmail,
+			Guest:         !comment.UserID.Valid,
+			Body:          comment.Body,
+			CreatedAt:     formatCommentTime(comment.CreatedAt),
+			Status:        comment.Status,
+			ImageFilename: comment.ImageFilename,
+			Reply:         comment.ParentID.Valid,
+		})
+	}
+	g.Templates.Comments.Execute(w, r, data)
+}
+
+func (g Galleries) commentID(r *http.Request) (uuid.UUID, error) {
+	return uuid.Parse(chi.URLParam(r, "commentID"))
+}
+
+// ModerateComment sets the status of a comment to the "status" form value.
+func (g Galleries) ModerateComment(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleCoOwner))
+	if !ok {
+		return
+	}
+	commentID, err := g.commentID(r)
+	if err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	status, err := models.ParseCommentStatus(r.FormValue("status"))
+	if err != nil {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	err = g.CommentService.SetStatus(gallery.ID, commentID, status)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s/comments", data.Path), http.StatusFound)
+}
+
+// DeleteComment removes a comment and its replies.
+func (g Galleries) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleCoOwner))
+	if !ok {
+		return
+	}
+	commentID, err := g.commentID(r)
+	if err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	err = g.CommentService.Delete(gallery.ID, commentID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s/comments", data.Path), http.StatusFound)
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"archive/zip"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/google/uuid"
+)
+
+// canDownload reports whether the visitor may download the gallery. Owners
+// and members always can; everybody else needs the gallery or their share
+// link to allow it.
+func canDownload(data GalleryDTO, gallery *models.Gallery) bool {
+	if data.Role.Can(models.RoleViewer) || gallery.AllowDownload {
+		return true
+	}
+	return data.ShareLink != nil && data.ShareLink.AllowDownload
+}
+
+func galleryMustAllowDownload(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
+	if !canDownload(*data, gallery) {
+		http.Error(w, "Downloads are disabled for this gallery", http.StatusForbidden)
+		return fmt.Errorf("gallery does not allow downloads")
+	}
+	return nil
+}
+
+// Download streams a ZIP archive with the gallery images. The archive is
+// written straight to the response, so memory usage does not grow with the
+// size of the gallery. An optional list of "image" query values restricts the
+// archive to those images, and "size" selects originals or web-sized copies.
+// Web-sized copies are marked with the watermark of the owner for visitors,
+// as they are the images shown in the gallery. Originals are never marked:
+// allowing downloads is how owners hand them out.
+func (g Galleries) Download(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.galleryMember, g.shareLink, userMustPrivateGallery, galleryMustAllowDownload)
+	if !ok {
+		return
+	}
+	images, err := g.GalleryService.Images(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	images = selectImages(images, r.URL.Query()["image"])
+	if len(images) == 0 {
+		http.Error(w, "No images to download", http.StatusNotFound)
+		return
+	}
+	size := models.ParseImageSize(r.URL.Query().Get("size"))
+	wm, err := g.visitorWatermark(gallery.UserID, data.Role != "" || size == models.ImageSizeOriginal)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if data.Role == "" {
+		g.recordView(r, gallery.ID, uuid.NullUUID{}, models.ViewDownload)
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archiveName(gallery.Title)))
+	zw := zip.NewWriter(w)
+	names := make(map[string]bool, len(images))
+	for _, image := range images {
+		// Photos are already compressed, so storing them avoids burning CPU
+		// for no noticeable gain.
+		// Images with the same original name are numbered.
+		name := models.AvailableFilename(image.Filename, names)
+		names[strings.ToLower(name)] = true
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			// Headers are already sent, so all we can do is stop writing.
+			fmt.Println(err)
+			return
+		}
+		if wm != nil {
+			image, err = g.WatermarkService.Marked(wm, image)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		err = g.GalleryService.WriteImage(entry, image, size)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// selectImages keeps the images whose ID is in ids. An empty selection means
+// every image.
+func selectImages(images []models.Image, ids []string) []models.Image {
+	if len(ids) == 0 {
+		return images
+	}
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	var result []models.Image
+	for _, image := range images {
+		if selected[image.ID.String()] {
+			result = append(result, image)
+		}
+	}
+	return result
+}
+
+func archiveName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '-'
+		}
+		return -1
+	}, title)
+	if name == "" {
+		name = "gallery"
+	}
+	return name + ".zip"
+}
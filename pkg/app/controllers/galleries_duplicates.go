@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/google/uuid"
+)
+
+// duplicatesDistance reads the "distance" value of r, the number of bits by
+// which the hashes of near-duplicates may differ.
+func duplicatesDistance(r *http.Request) int {
+	distance, err := strconv.Atoi(r.FormValue("distance"))
+	if err != nil || distance < 0 || distance > models.MaxDuplicateDistance {
+		return models.DefaultDuplicateDistance
+	}
+	return distance
+}
+
+// Duplicates groups the near-duplicate images of the gallery, such as the
+// frames of a burst, so the user can keep the best one of each group and
+// delete the others. The "distance" query value sets how similar the images
+// must be.
+func (g Galleries) Duplicates(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		GalleryDTO
+		Distance    int
+		MaxDistance int
+		Groups      [][]Image
+	}
+	gallery, ok := g.validate(w, r, &data.GalleryDTO, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	data.Title = gallery.Title
+	data.Distance = duplicatesDistance(r)
+	data.MaxDistance = models.MaxDuplicateDistance
+	groups, err := g.GalleryService.NearDuplicates(gallery.ID, data.Distance)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	for _, group := range groups {
+		data.Groups = append(data.Groups, g.imageDTOs(gallery, group, nil))
+	}
+	g.Templates.Duplicates.Execute(w, r, data)
+}
+
+// DeleteImages moves the images selected in the "image_id" form values to
+// the trash, and goes back to the near-duplicates of the gallery.
+func (g Galleries) DeleteImages(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	r.ParseForm()
+	var imageIDs []uuid.UUID
+	for _, value := range r.Form["image_id"] {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			continue
+		}
+		imageIDs = append(imageIDs, id)
+	}
+	_, err := g.GalleryService.DeleteImages(gallery.ID, imageIDs)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	query := url.Values{
+		"distance": {strconv.Itoa(duplicatesDistance(r))},
+	}
+	duplicatesPath := fmt.Sprintf("%s/duplicates?%s", data.Path, query.Encode())
+	http.Redirect(w, r, duplicatesPath, http.StatusFound)
+}
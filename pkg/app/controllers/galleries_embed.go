@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+)
+
+// embedStatsDays is the number of days covered by the embed views shown to
+// the owner.
+const embedStatsDays = 30
+
+// EmbedSettings are the embedding options of a gallery, only shown to its
+// owner and co-owners.
+type EmbedSettings struct {
+	// Origins are the sites allowed to embed the gallery, one per line.
+	Origins string
+	// IframeCode and ScriptCode are the snippets to paste into those sites.
+	IframeCode string
+	ScriptCode string
+	Views      []models.EmbedViews
+	StatsDays  int
+}
+
+// embedURL returns the address of the embedded view of a gallery.
+func (g Galleries) embedURL(galleryPath string) string {
+	return g.BaseURL + galleryPath + "/embed"
+}
+
+// embedSettings reads the embedding options of a gallery.
+func (g Galleries) embedSettings(gallery *models.Gallery) (*EmbedSettings, error) {
+	origins, err := g.EmbedService.Origins(gallery.ID)
+	if err != nil {
+		return nil, err
+	}
+	views, err := g.EmbedService.Views(gallery.ID, time.Now().AddDate(0, 0, -embedStatsDays))
+	if err != nil {
+		return nil, err
+	}
+	src := html.EscapeString(g.embedURL(galleryPath(gallery)))
+	title := html.EscapeString(gallery.Title)
+	return &EmbedSettings{
+		Origins: strings.Join(origins, "\n"),
+		IframeCode: fmt.Sprintf(`<iframe src="%s" title="%s" loading="lazy" style="width: 100%%; height: 600px; border: 0;"></iframe>`,
+			src, title),
+		ScriptCode: fmt.Sprintf(`<div data-lenslocked-gallery="%s" data-layout="grid" data-title="%s"></div>`+"\n"+
+			`<script async src="%s/assets/embed.js"></script>`, src, title, html.EscapeString(g.BaseURL)),
+		Views:     views,
+		StatsDays: embedStatsDays,
+	}, nil
+}
+
+// refererOrigin returns the origin of the page that linked to r, which is
+// the embedding page for embedded views, or an empty string.
+func refererOrigin(r *http.Request) string {
+	referer := r.Referer()
+	if referer == "" {
+		return ""
+	}
+	origin, err := models.ParseOrigin(referer)
+	if err != nil {
+		return ""
+	}
+	return origin
+}
+
+// Embed is the view of a public gallery that other sites show in an
+// iframe, as a grid or, when the "layout" query value is "carousel", as a
+// carousel. Browsers only show it on the sites the owner allowed.
+func (g Galleries) Embed(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		GalleryDTO
+		Carousel   bool
+		GalleryURL string
+	}
+	gallery, ok := g.validate(w, r, &data.GalleryDTO, galleryMustBePublic)
+	if !ok {
+		return
+	}
+	origins, err := g.EmbedService.Origins(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", "frame-ancestors "+strings.Join(append([]string{"'self'"}, origins...), " "))
+	setRobotsTag(w, gallery)
+	// Views from other sites are not counted, the browser does not show
+	// the gallery there.
+	if origin := refererOrigin(r); slices.Contains(origins, origin) {
+		err = g.EmbedService.CountView(gallery.ID, origin)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	images, err := g.GalleryService.Images(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	wm, err := g.visitorWatermark(gallery.UserID, false)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	data.Title = gallery.Title
+	data.Images = g.imageDTOs(gallery, images, wm)
+	for i := range data.Images {
+		data.Images[i].URL = g.BaseURL + data.Images[i].URL
+		data.Images[i].Page = g.BaseURL + imagePagePath(data.GalleryDTO, i+1, 0)
+	}
+	data.Carousel = r.URL.Query().Get("layout") == "carousel"
+	data.GalleryURL = g.BaseURL + galleryPath(gallery)
+	g.Templates.Embed.Execute(w, r, data)
+}
+
+// UpdateEmbed sets the sites allowed to embed the gallery, from the
+// "origins" form value.
+func (g Galleries) UpdateEmbed(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleCoOwner))
+	if !ok {
+		return
+	}
+	origins := strings.FieldsFunc(r.FormValue("origins"), func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\t' || c == '\r' || c == '\n'
+	})
+	err := g.EmbedService.SetOrigins(gallery.ID, origins)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit#embed", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
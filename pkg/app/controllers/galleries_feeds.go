@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/AguilaMike/lenslocked/pkg/internal/feed"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// feedLimit is the number of entries of a feed.
+const feedLimit = 50
+
+// galleryMustBePublic only lets published galleries through, whoever asks
+// for them.
+func galleryMustBePublic(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
+	if !gallery.Public {
+		http.Error(w, "Gallery not found", http.StatusNotFound)
+		return fmt.Errorf("gallery is not public")
+	}
+	return nil
+}
+
+// feedImage returns an image of a public gallery as attached to feed
+// entries. Feed readers load it long after the feed was fetched, so the URL
+// is not signed.
+func (g Galleries) feedImage(gallery *models.Gallery, imageID uuid.UUID, version string, extension string) *feed.Image {
+	return &feed.Image{
+		URL:  g.BaseURL + publicImagePath(galleryPath(gallery), imageID, version),
+		Type: mime.TypeByExtension(extension),
+	}
+}
+
+// writeFeed answers with f in the format named by the extension of the
+// request path, ".atom" or ".rss". Conditional requests are answered from
+// the ETag and the last update of the feed.
+func writeFeed(w http.ResponseWriter, r *http.Request, f feed.Feed) {
+	var buf bytes.Buffer
+	var err error
+	switch path.Ext(r.URL.Path) {
+	case ".atom":
+		w.Header().Set("Content-Type", feed.AtomContentType)
+		err = f.WriteAtom(&buf)
+	case ".rss":
+		w.Header().Set("Content-Type", feed.RSSContentType)
+		err = f.WriteRSS(&buf)
+	default:
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:10])+`"`)
+	// Readers may keep the feed, as long as they check it is current.
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", f.LastUpdated(), bytes.NewReader(buf.Bytes()))
+}
+
+// unixTime converts the timestamps of the models, which are 0 or nil when
+// unset.
+func unixTime(sec *int64) time.Time {
+	if sec == nil || *sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(*sec, 0)
+}
+
+// ProfileFeed is the Atom or RSS feed of the public galleries of a user,
+// newest first.
+func (g Galleries) ProfileFeed(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	galleries, _, err := g.GalleryService.PublicByUserID(userID, models.PageRequest{Limit: feedLimit})
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	wm, err := g.visitorWatermark(userID, false)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	profileURL := fmt.Sprintf("%s/profiles/%s", g.BaseURL, userID)
+	f := feed.Feed{
+		ID:        profileURL,
+		Title:     "Public Galleries",
+		Subtitle:  "New galleries published by this photographer.",
+		Link:      profileURL,
+		Self:      g.BaseURL + r.URL.Path,
+		Author:    photographerName,
+		AuthorURI: profileURL,
+	}
+	for _, gallery := range galleries {
+		entry := feed.Entry{
+			ID:        "urn:uuid:" + gallery.ID.String(),
+			Title:     gallery.Title,
+			Link:      g.BaseURL + galleryPath(&gallery),
+			Published: unixTime(&gallery.CreatedAt),
+			Updated:   unixTime(gallery.UpdatedAt),
+		}
+		if entry.Updated.IsZero() {
+			entry.Updated = entry.Published
+		}
+		if gallery.ThumbnailID.Valid {
+			// The extension of thumbnails is not known here, so readers
+			// only get a thumbnail and no enclosure in RSS feeds.
+			entry.Image = g.feedImage(&gallery, gallery.ThumbnailID.UUID, gallery.ThumbnailVersion(wm.Version()), "")
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	writeFeed(w, r, f)
+}
+
+// GalleryFeed is the Atom or RSS feed of the images added to a public
+// gallery, newest first.
+func (g Galleries) GalleryFeed(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, galleryMustBePublic)
+	if !ok {
+		return
+	}
+	images, err := g.GalleryService.NewestImages(gallery.ID, feedLimit)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	wm, err := g.visitorWatermark(gallery.UserID, false)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	galleryURL := g.BaseURL + galleryPath(gallery)
+	profileURL := fmt.Sprintf("%s/profiles/%s", g.BaseURL, gallery.UserID)
+	f := feed.Feed{
+		ID:        "urn:uuid:" + gallery.ID.String(),
+		Title:     gallery.Title,
+		Subtitle:  "New images in " + gallery.Title + ".",
+		Link:      galleryURL,
+		Self:      g.BaseURL + r.URL.Path,
+		Updated:   unixTime(gallery.UpdatedAt),
+		Author:    photographerName,
+		AuthorURI: profileURL,
+	}
+	if f.Updated.IsZero() {
+		f.Updated = unixTime(&gallery.CreatedAt)
+	}
+	for _, image := range images {
+		title := image.Caption
+		if title == "" {
+			title = image.Filename
+		}
+		entry := feed.Entry{
+			ID:      "urn:uuid:" + image.ID.String(),
+			Title:   title,
+			Link:    fmt.Sprintf("%s#image-%s", galleryURL, image.ID),
+			Summary: image.AltText,
+			Updated: unixTime(&image.CreatedAt),
+			Image:   g.feedImage(gallery, image.ID, image.Version(wm.Version()), image.Extension),
+		}
+		if !image.Edit.Edited() && wm.Version() == "" {
+			// Served as uploaded.
+			entry.Image.Length = image.Size
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	setRobotsTag(w, gallery)
+	writeFeed(w, r, f)
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+)
+
+// EditImage rotates, flips or crops an image, depending on whether the
+// "action" form value is "rotate-left", "rotate-right", "flip-horizontal",
+// "flip-vertical" or "crop". Crops are taken from the "aspect" form value,
+// e.g. "4:3", or when it is empty from the "left", "top", "width" and
+// "height" form values, in percent of the image.
+func (g Galleries) EditImage(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	image, ok := g.galleryImage(w, r, gallery)
+	if !ok {
+		return
+	}
+	edit := image.Edit
+	var err error
+	switch r.FormValue("action") {
+	case "rotate-left":
+		edit = edit.Rotate(false)
+	case "rotate-right":
+		edit = edit.Rotate(true)
+	case "flip-horizontal":
+		edit = edit.Flip(true)
+	case "flip-vertical":
+		edit = edit.Flip(false)
+	case "crop":
+		edit, err = g.cropImage(image, edit, r)
+	default:
+		http.Error(w, "Please choose how to edit the image.", http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		err = g.GalleryService.EditImage(&image, edit)
+	}
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+// RevertImage drops the edits of an image.
+func (g Galleries) RevertImage(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	image, ok := g.galleryImage(w, r, gallery)
+	if !ok {
+		return
+	}
+	err := g.GalleryService.EditImage(&image, models.ImageEdit{})
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+// galleryImage finds the image of the gallery in the "imageID" URL param.
+func (g Galleries) galleryImage(w http.ResponseWriter, r *http.Request, gallery *models.Gallery) (models.Image, bool) {
+	imageID, err := g.imageID(r)
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return models.Image{}, false
+	}
+	image, err := g.GalleryService.Image(gallery.ID, imageID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return models.Image{}, false
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return models.Image{}, false
+	}
+	return image, true
+}
+
+// cropImage returns edit cropped as asked in the form values of r.
+func (g Galleries) cropImage(img models.Image, edit models.ImageEdit, r *http.Request) (models.ImageEdit, error) {
+	if aspect := r.FormValue("aspect"); aspect != "" {
+		ratioWidth, ratioHeight, ok := strings.Cut(aspect, ":")
+		if !ok {
+			return edit, models.ErrInvalidImageEdit
+		}
+		rw, err := strconv.Atoi(ratioWidth)
+		if err != nil {
+			return edit, models.ErrInvalidImageEdit
+		}
+		rh, err := strconv.Atoi(ratioHeight)
+		if err != nil {
+			return edit, models.ErrInvalidImageEdit
+		}
+		width, height, err := g.GalleryService.ImageDimensions(img)
+		if err != nil {
+			return edit, err
+		}
+		return edit.CropToAspect(width, height, rw, rh)
+	}
+	var values [4]int
+	for i, name := range []string{"left", "top", "width", "height"} {
+		percent, err := strconv.ParseFloat(r.FormValue(name), 64)
+		if err != nil || !(percent >= 0 && percent <= 100) {
+			return edit, models.ErrInvalidImageEdit
+		}
+		values[i] = int(percent*models.CropScale/100 + 0.5)
+	}
+	left, top, width, height := values[0], values[1], values[2], values[3]
+	return edit.CropTo(image.Rect(left, top, left+width, top+height))
+}
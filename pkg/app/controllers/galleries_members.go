@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/context"
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type GalleryMember struct {
+	ID       uuid.UUID
+	Email    string
+	Role     models.GalleryRole
+	Accepted bool
+}
+
+func galleryMemberDTOs(members []models.GalleryMember) []GalleryMember {
+	var result []GalleryMember
+	for _, member := range members {
+		result = append(result, GalleryMember{
+			ID:       member.ID,
+			Email:    member.Email,
+			Role:     member.Role,
+			Accepted: member.AcceptedAt != nil,
+		})
+	}
+	return result
+}
+
+// InviteMember emails an invitation to the "email" form value for the role
+// in the "role" form value.
+func (g Galleries) InviteMember(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleCoOwner))
+	if !ok {
+		return
+	}
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email == "" {
+		http.Error(w, "Email address is required", http.StatusBadRequest)
+		return
+	}
+	role, err := models.ParseGalleryRole(r.FormValue("role"))
+	if err != nil {
+		http.Error(w, "Please pick a valid role", http.StatusBadRequest)
+		return
+	}
+	member, err := g.MemberService.Invite(gallery.ID, email, role, data.UserID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	vals := url.Values{
+		"token": {member.Token},
+	}
+	err = g.EmailService.GalleryInvitation(member.Email, gallery.Title, member.Role, g.BaseURL+"/invitations?"+vals.Encode())
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleCoOwner))
+	if !ok {
+		return
+	}
+	memberID, err := uuid.Parse(chi.URLParam(r, "memberID"))
+	if err != nil {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	err = g.MemberService.Remove(gallery.ID, memberID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+type invitationData struct {
+	Token        string
+	GalleryTitle string
+	Role         models.GalleryRole
+}
+
+// Invitation shows the gallery an invitation token is for, so the user can
+// accept it.
+func (g Galleries) Invitation(w http.ResponseWriter, r *http.Request) {
+	data, ok := g.invitation(w, r)
+	if !ok {
+		return
+	}
+	g.Templates.Invitation.Execute(w, r, data)
+}
+
+func (g Galleries) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	data, ok := g.invitation(w, r)
+	if !ok {
+		return
+	}
+	member, err := g.MemberService.Accept(data.Token, context.User(r.Context()))
+	if err != nil {
+		g.Templates.Invitation.Execute(w, r, data, err)
+		return
+	}
+	gallery, err := g.GalleryService.ByID(member.GalleryID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Gallery not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	path := galleryPath(gallery)
+	if member.Role.Can(models.RoleContributor) {
+		path += "/edit"
+	}
+	http.Redirect(w, r, path, http.StatusFound)
+}
+
+func (g Galleries) invitation(w http.ResponseWriter, r *http.Request) (invitationData, bool) {
+	var data invitationData
+	data.Token = r.FormValue("token")
+	member, err := g.MemberService.ByToken(data.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "This invitation is invalid, expired or was already accepted", http.StatusNotFound)
+			return data, false
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return data, false
+	}
+	gallery, err := g.GalleryService.ByID(member.GalleryID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "This invitation is invalid or was already accepted", http.StatusNotFound)
+			return data, false
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return data, false
+	}
+	data.GalleryTitle = gallery.Title
+	data.Role = member.Role
+	return data, true
+}
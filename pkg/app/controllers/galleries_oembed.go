@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/google/uuid"
+)
+
+const (
+	siteName = "Lenslocked"
+	// photographerName stands for the owner of a gallery wherever a name is
+	// expected, as users have no public name.
+	photographerName = "Lenslocked photographer"
+	// oembedCacheAge is how long, in seconds, consumers may keep embeds.
+	oembedCacheAge = 3600
+)
+
+// PageMeta describes a page to the sites that preview links to it, through
+// Open Graph and Twitter card meta tags.
+type PageMeta struct {
+	// Type is the Open Graph type of the page, e.g. "website".
+	Type        string
+	Title       string
+	Description string
+	// URL is the canonical address of the page.
+	URL      string
+	Image    string
+	ImageAlt string
+	// OEmbedURL is set for pages that can be embedded.
+	OEmbedURL string
+	// NoIndex asks search engines not to list the page.
+	NoIndex bool
+}
+
+// imageCountText describes the size of a gallery.
+func imageCountText(count int) string {
+	if count == 1 {
+		return "1 image"
+	}
+	return fmt.Sprintf("%d images", count)
+}
+
+// metaImageURL returns the absolute URL of an image shown in link previews.
+// Images of public galleries get URLs that do not expire, as previews are
+// kept for long.
+func (g Galleries) metaImageURL(gallery *models.Gallery, imageID uuid.UUID, version func(watermark string) string, wm *models.Watermark) string {
+	if !gallery.Public {
+		return g.BaseURL + g.imageURL(gallery, imageID, version, wm)
+	}
+	watermark := ""
+	if wm != nil {
+		watermark = wm.Version()
+	}
+	return g.BaseURL + publicImagePath(galleryPath(gallery), imageID, version(watermark))
+}
+
+// oembedURL returns the oEmbed endpoint describing the page at pageURL.
+func (g Galleries) oembedURL(pageURL string) string {
+	return g.BaseURL + "/oembed?" + url.Values{"format": {"json"}, "url": {pageURL}}.Encode()
+}
+
+// galleryMeta describes the show page of a gallery of count images.
+func (g Galleries) galleryMeta(gallery *models.Gallery, count int, wm *models.Watermark) *PageMeta {
+	meta := &PageMeta{
+		Type:        "website",
+		Title:       gallery.Title,
+		Description: fmt.Sprintf("A gallery of %s on %s.", imageCountText(count), siteName),
+		URL:         g.BaseURL + galleryPath(gallery),
+		NoIndex:     !indexable(gallery),
+	}
+	if gallery.ThumbnailID.Valid {
+		meta.Image = g.metaImageURL(gallery, gallery.ThumbnailID.UUID, gallery.ThumbnailVersion, wm)
+		meta.ImageAlt = gallery.Title
+	}
+	if gallery.Public {
+		meta.OEmbedURL = g.oembedURL(meta.URL)
+	}
+	return meta
+}
+
+// imageMeta describes the viewer page of the n-th of count images of a
+// gallery.
+func (g Galleries) imageMeta(gallery *models.Gallery, image models.Image, n, count int, wm *models.Watermark) *PageMeta {
+	meta := &PageMeta{
+		Type:        "website",
+		Title:       gallery.Title,
+		Description: fmt.Sprintf("Image %d of %d in %s.", n, count, gallery.Title),
+		URL:         fmt.Sprintf("%s%s/images/%d", g.BaseURL, galleryPath(gallery), n),
+		Image:       g.metaImageURL(gallery, image.ID, image.Version, wm),
+		ImageAlt:    image.AltText,
+		NoIndex:     !indexable(gallery),
+	}
+	if image.Caption != "" {
+		meta.Title = image.Caption
+	}
+	if meta.ImageAlt == "" {
+		meta.ImageAlt = image.Filename
+	}
+	if gallery.Public {
+		meta.OEmbedURL = g.oembedURL(meta.URL)
+	}
+	return meta
+}
+
+// oembed is an oEmbed response, see https://oembed.com.
+type oembed struct {
+	Type            string `json:"type"`
+	Version         string `json:"version"`
+	Title           string `json:"title,omitempty"`
+	AuthorName      string `json:"author_name,omitempty"`
+	AuthorURL       string `json:"author_url,omitempty"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	CacheAge        int    `json:"cache_age,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+	URL             string `json:"url,omitempty"`
+	HTML            string `json:"html,omitempty"`
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+}
+
+// fitSize scales width and height down to fit within maxWidth and
+// maxHeight, keeping their ratio. Limits of 0 are ignored.
+func fitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	if maxWidth > 0 && width > maxWidth {
+		height = max(1, height*maxWidth/width)
+		width = maxWidth
+	}
+	if maxHeight > 0 && height > maxHeight {
+		width = max(1, width*maxHeight/height)
+		height = maxHeight
+	}
+	return width, height
+}
+
+// oembedTarget finds the gallery of a page URL of this site, and the number
+// of the image when it is the URL of the viewer page of an image.
+func (g Galleries) oembedTarget(rawURL string) (*models.Gallery, int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, 0, models.ErrNotFound
+	}
+	base, err := url.Parse(g.BaseURL)
+	if err != nil || u.Host != base.Host {
+		return nil, 0, models.ErrNotFound
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 3 || parts[0] != "galleries" {
+		return nil, 0, models.ErrNotFound
+	}
+	userID, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, 0, models.ErrNotFound
+	}
+	var n int
+	switch len(parts) {
+	case 3:
+	case 5:
+		n, err = strconv.Atoi(parts[4])
+		if parts[3] != "images" || err != nil || n < 1 {
+			return nil, 0, models.ErrNotFound
+		}
+	default:
+		return nil, 0, models.ErrNotFound
+	}
+	gallery, err := g.GalleryService.BySlug(userID, parts[2])
+	if err != nil {
+		return nil, 0, err
+	}
+	return gallery, n, nil
+}
+
+// OEmbed describes the public gallery or image at the "url" query value to
+// the sites that embed it. Images are embedded as photos, and galleries as
+// their thumbnail linking to the gallery. The "maxwidth" and "maxheight"
+// query values limit the size of the embed.
+func (g Galleries) OEmbed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		http.Error(w, "Only the json format is supported", http.StatusNotImplemented)
+		return
+	}
+	maxWidth, _ := strconv.Atoi(query.Get("maxwidth"))
+	maxHeight, _ := strconv.Atoi(query.Get("maxheight"))
+	gallery, n, err := g.oembedTarget(query.Get("url"))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	// Private galleries are not found, as they are by their pages.
+	if !gallery.Public {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	images, err := g.GalleryService.Images(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	var image *models.Image
+	if n > 0 {
+		if n > len(images) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		image = &images[n-1]
+	} else if gallery.ThumbnailID.Valid {
+		for i := range images {
+			if images[i].ID == gallery.ThumbnailID.UUID {
+				image = &images[i]
+			}
+		}
+	}
+	wm, err := g.visitorWatermark(gallery.UserID, false)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	galleryURL := g.BaseURL + galleryPath(gallery)
+	embed := oembed{
+		Type:         "link",
+		Version:      "1.0",
+		Title:        gallery.Title,
+		AuthorName:   photographerName,
+		AuthorURL:    fmt.Sprintf("%s/profiles/%s", g.BaseURL, gallery.UserID),
+		ProviderName: siteName,
+		ProviderURL:  g.BaseURL,
+		CacheAge:     oembedCacheAge,
+	}
+	if image != nil {
+		width, height, err := g.GalleryService.ImageDimensions(*image)
+		if err != nil {
+			// Embedded as a plain link.
+			fmt.Println(err)
+			image = nil
+		} else {
+			width, height = image.Edit.Size(width, height)
+			width, height = fitSize(width, height, maxWidth, maxHeight)
+			embed.ThumbnailURL = g.BaseURL + publicImagePath(galleryPath(gallery), image.ID, image.Version(wm.Version()))
+			embed.ThumbnailWidth, embed.ThumbnailHeight = width, height
+			embed.Width, embed.Height = width, height
+		}
+	}
+	switch {
+	case image != nil && n > 0:
+		embed.Type = "photo"
+		embed.URL = embed.ThumbnailURL
+		if image.Caption != "" {
+			embed.Title = image.Caption
+		}
+	case image != nil:
+		embed.Type = "rich"
+		embed.HTML = fmt.Sprintf(`<a href="%s"><img src="%s" alt="%s" width="%d" height="%d"></a>`,
+			html.EscapeString(galleryURL), html.EscapeString(embed.ThumbnailURL), html.EscapeString(gallery.Title),
+			embed.Width, embed.Height)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", oembedCacheAge))
+	err = json.NewEncoder(w).Encode(embed)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
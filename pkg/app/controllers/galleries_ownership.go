@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/context"
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+)
+
+// PendingTransfer is an ownership transfer waiting for its recipient, as
+// shown to the owner.
+type PendingTransfer struct {
+	Email     string
+	ExpiresAt string
+}
+
+// TransferOwnership emails an offer to own the gallery to the "email" form
+// value.
+func (g Galleries) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleOwner))
+	if !ok {
+		return
+	}
+	user := context.User(r.Context())
+	transfer, err := g.OwnershipService.Create(gallery.ID, user, r.FormValue("email"))
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	vals := url.Values{
+		"token": {transfer.Token},
+	}
+	err = g.EmailService.OwnershipTransferRequest(transfer.Email, gallery.Title, user.Email, g.BaseURL+"/transfers?"+vals.Encode())
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+// CancelOwnershipTransfer withdraws the pending transfer of the gallery.
+func (g Galleries) CancelOwnershipTransfer(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleOwner))
+	if !ok {
+		return
+	}
+	err := g.OwnershipService.Cancel(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+// pendingTransfer returns the pending transfer of the gallery, or nil.
+func (g Galleries) pendingTransfer(gallery *models.Gallery) (*PendingTransfer, error) {
+	transfer, err := g.OwnershipService.ByGalleryID(gallery.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &PendingTransfer{
+		Email:     transfer.Email,
+		ExpiresAt: time.Unix(transfer.ExpiresAt, 0).UTC().Format("2006-01-02 15:04"),
+	}, nil
+}
+
+type ownershipTransferData struct {
+	Token        string
+	GalleryTitle string
+	FromEmail    string
+	// Title is the title the gallery will have. TitleTaken is set when the
+	// user already has a gallery with the current title and must pick
+	// another one.
+	Title      string
+	TitleTaken bool
+}
+
+// OwnershipTransfer shows the gallery a transfer token is for, so the user
+// can accept it.
+func (g Galleries) OwnershipTransfer(w http.ResponseWriter, r *http.Request) {
+	data, ok := g.ownershipTransfer(w, r)
+	if !ok {
+		return
+	}
+	g.Templates.Transfer.Execute(w, r, data)
+}
+
+// AcceptOwnershipTransfer makes the user the owner of the gallery, under
+// the title in the "title" form value, and lets both parties know by email.
+func (g Galleries) AcceptOwnershipTransfer(w http.ResponseWriter, r *http.Request) {
+	data, ok := g.ownershipTransfer(w, r)
+	if !ok {
+		return
+	}
+	user := context.User(r.Context())
+	data.Title = r.FormValue("title")
+	gallery, err := g.OwnershipService.Accept(data.Token, user, data.Title)
+	if err != nil {
+		if errors.Is(err, models.ErrGalleryTitleTaken) {
+			data.TitleTaken = true
+		}
+		g.Templates.Transfer.Execute(w, r, data, err)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", galleryPath(gallery))
+	err = g.EmailService.OwnershipTransferred(data.FromEmail, gallery.Title, user.Email)
+	if err != nil {
+		fmt.Println(err)
+	}
+	err = g.EmailService.OwnershipReceived(user.Email, gallery.Title, g.BaseURL+editPath)
+	if err != nil {
+		fmt.Println(err)
+	}
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) ownershipTransfer(w http.ResponseWriter, r *http.Request) (ownershipTransferData, bool) {
+	var data ownershipTransferData
+	data.Token = r.FormValue("token")
+	transfer, err := g.OwnershipService.ByToken(data.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "This transfer is invalid, expired or was already accepted", http.StatusNotFound)
+			return data, false
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return data, false
+	}
+	gallery, err := g.GalleryService.ByID(transfer.GalleryID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "This transfer is invalid, expired or was already accepted", http.StatusNotFound)
+			return data, false
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return data, false
+	}
+	data.GalleryTitle = gallery.Title
+	data.FromEmail = transfer.FromEmail
+	data.Title = gallery.Title
+	data.TitleTaken, err = g.GalleryService.TitleTaken(context.User(r.Context()).ID, gallery.Title)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return data, false
+	}
+	return data, true
+}
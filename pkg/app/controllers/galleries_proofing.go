@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Proofing describes the selection of the current visitor.
+type Proofing struct {
+	Picked    int
+	Limit     int
+	Submitted bool
+}
+
+// LimitReached reports whether the visitor cannot pick more images.
+func (p Proofing) LimitReached() bool {
+	return p.Limit > 0 && p.Picked >= p.Limit
+}
+
+func proofingDTO(gallery *models.Gallery, selection *models.Selection) *Proofing {
+	return &Proofing{
+		Picked:    len(selection.Picks),
+		Limit:     gallery.SelectionLimit,
+		Submitted: selection.Submitted(),
+	}
+}
+
+type Selection struct {
+	ID          uuid.UUID
+	ClientName  string
+	ClientEmail string
+	SubmittedAt string
+	Picks       []models.Pick
+	// Lightroom lists the picked filenames without extension, ready to be
+	// pasted in a Lightroom "Filename contains" library filter.
+	Lightroom string
+}
+
+func selectionDTO(selection models.Selection) Selection {
+	item := Selection{
+		ID:          selection.ID,
+		ClientName:  selection.ClientName,
+		ClientEmail: selection.ClientEmail,
+		Picks:       selection.Picks,
+	}
+	if selection.SubmittedAt != nil {
+		item.SubmittedAt = time.Unix(*selection.SubmittedAt, 0).UTC().Format("2006-01-02 15:04")
+	}
+	var names []string
+	for _, pick := range selection.Picks {
+		names = append(names, strings.TrimSuffix(pick.Filename, filepath.Ext(pick.Filename)))
+	}
+	item.Lightroom = strings.Join(names, ", ")
+	return item
+}
+
+func proofingCookie(galleryID uuid.UUID) string {
+	return "proofing_" + galleryID.String()
+}
+
+// selection returns the selection of the current visitor. Visitors who have
+// not picked anything yet get an empty, unsaved selection.
+func (g Galleries) selection(r *http.Request, gallery *models.Gallery) (*models.Selection, error) {
+	token, err := ReadCookie(r, proofingCookie(gallery.ID))
+	if err != nil {
+		return &models.Selection{GalleryID: gallery.ID}, nil
+	}
+	selection, err := g.ProofingService.ByToken(gallery.ID, token)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return &models.Selection{GalleryID: gallery.ID}, nil
+		}
+		return nil, err
+	}
+	return selection, nil
+}
+
+// startedSelection is like selection but saves a new selection, and hands
+// its token to the visitor, when there was none.
+func (g Galleries) startedSelection(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) (*models.Selection, error) {
+	selection, err := g.selection(r, gallery)
+	if err != nil {
+		return nil, err
+	}
+	if selection.ID != uuid.Nil {
+		return selection, nil
+	}
+	var shareLinkID uuid.NullUUID
+	if data.ShareLink != nil {
+		shareLinkID = uuid.NullUUID{UUID: data.ShareLink.ID, Valid: true}
+	}
+	selection, err = g.ProofingService.Start(gallery.ID, shareLinkID)
+	if err != nil {
+		return nil, err
+	}
+	SetCookie(w, proofingCookie(gallery.ID), selection.Token)
+	return selection, nil
+}
+
+func galleryMustAllowProofing(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
+	if !gallery.ProofingEnabled {
+		http.Error(w, "This gallery does not accept selections", http.StatusForbidden)
+		return fmt.Errorf("gallery does not allow proofing")
+	}
+	return nil
+}
+
+func (g Galleries) proofingRedirect(w http.ResponseWriter, r *http.Request, data GalleryDTO, anchor string) {
+	path := data.Path + data.ShareQuery()
+	if anchor != "" {
+		path += "#" + anchor
+	}
+	http.Redirect(w, r, path, http.StatusFound)
+}
+
+// TogglePick adds an image to the selection of the visitor, or removes it.
+func (g Galleries) TogglePick(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.galleryMember, g.shareLink, userMustPrivateGallery, galleryMustAllowProofing)
+	if !ok {
+		return
+	}
+	imageID, err := g.imageID(r)
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	selection, err := g.startedSelection(w, r, &data, gallery)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	err = g.ProofingService.Toggle(selection, imageID, gallery.SelectionLimit)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	g.proofingRedirect(w, r, data, "image-"+imageID.String())
+}
+
+// SetPickNote saves the "note" form value on a picked image.
+func (g Galleries) SetPickNote(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.galleryMember, g.shareLink, userMustPrivateGallery, galleryMustAllowProofing)
+	if !ok {
+		return
+	}
+	imageID, err := g.imageID(r)
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	selection, err := g.selection(r, gallery)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	if !selection.Picked(imageID) {
+		http.Error(w, "Please pick the image before adding a note", http.StatusBadRequest)
+		return
+	}
+	err = g.ProofingService.SetNote(selection, imageID, r.FormValue("note"))
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	g.proofingRedirect(w, r, data, "image-"+imageID.String())
+}
+
+// SubmitSelection sends the selection of the visitor to the owner of the
+// gallery, who is notified by email.
+func (g Galleries) SubmitSelection(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.galleryMember, g.shareLink, userMustPrivateGallery, galleryMustAllowProofing)
+	if !ok {
+		return
+	}
+	selection, err := g.selection(r, gallery)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	email := strings.TrimSpace(r.FormValue("email"))
+	err = g.ProofingService.Submit(selection, name, email)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	owner, err := g.UserService.ByID(gallery.UserID)
+	if err == nil {
+		selectionsURL := fmt.Sprintf("%s%s/proofing", g.BaseURL, data.Path)
+		err = g.EmailService.SelectionSubmitted(owner.Email, gallery.Title, name, len(selection.Picks), selectionsURL)
+	}
+	if err != nil {
+		// The selection is saved, so the visitor does not need to know.
+		fmt.Println(err)
+	}
+	g.proofingRedirect(w, r, data, "")
+}
+
+// Selections lists the selections submitted for a gallery.
+func (g Galleries) Selections(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		GalleryDTO
+		Selections []Selection
+	}
+	gallery, ok := g.validate(w, r, &data.GalleryDTO, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	data.Title = gallery.Title
+	selections, err := g.ProofingService.Submitted(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	for _, selection := range selections {
+		data.Selections = append(data.Selections, selectionDTO(selection))
+	}
+	g.Templates.Selections.Execute(w, r, data)
+}
+
+// csvCell escapes a value written by visitors so that spreadsheets opening
+// the CSV do not run it as a formula.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ExportSelection downloads a selection as CSV.
+func (g Galleries) ExportSelection(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	selectionID, err := uuid.Parse(chi.URLParam(r, "selectionID"))
+	if err != nil {
+		http.Error(w, "Selection not found", http.StatusNotFound)
+		return
+	}
+	selection, err := g.ProofingService.ByID(gallery.ID, selectionID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Selection not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "selection-"+selection.ID.String()+".csv"))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"filename", "note"})
+	for _, pick := range selection.Picks {
+		cw.Write([]string{csvCell(pick.Filename), csvCell(pick.Note)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		fmt.Println(err)
+	}
+}
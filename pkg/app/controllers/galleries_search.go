@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/google/uuid"
+)
+
+// SearchResult is a gallery found by a search, with the texts that matched.
+type SearchResult struct {
+	GalleryDTO
+	Highlights []template.HTML
+}
+
+// SearchPage is a page of search results.
+type SearchPage struct {
+	Query   string
+	Results []SearchResult
+	Pagination
+}
+
+// highlight escapes s and marks the words the search matched.
+func highlight(s string) template.HTML {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, models.HighlightStart, "<mark>")
+	s = strings.ReplaceAll(s, models.HighlightStop, "</mark>")
+	return template.HTML(s)
+}
+
+func searchPageURL(path, query string, page int) string {
+	values := url.Values{"q": {query}}
+	if page > 1 {
+		values.Set("page", strconv.Itoa(page))
+	}
+	return path + "?" + values.Encode()
+}
+
+// search runs the "q" query value, at the "page" query value, over the
+// galleries of userID or, when it is not set, over published galleries.
+func (g Galleries) search(r *http.Request, userID uuid.NullUUID) (*SearchPage, error) {
+	query := r.URL.Query()
+	data := SearchPage{
+		Query: strings.TrimSpace(query.Get("q")),
+	}
+	if data.Query == "" {
+		return &data, nil
+	}
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	results, more, err := g.SearchService.Search(models.SearchQuery{
+		Text:   data.Query,
+		UserID: userID,
+		Page:   page,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Results of published galleries come from many owners, whose
+	// watermarks are looked up once each.
+	watermarks := map[uuid.UUID]*models.Watermark{}
+	for _, result := range results {
+		wm, ok := watermarks[result.Gallery.UserID]
+		if !ok {
+			wm, err = g.visitorWatermark(result.Gallery.UserID, userID.Valid)
+			if err != nil {
+				return nil, err
+			}
+			watermarks[result.Gallery.UserID] = wm
+		}
+		item := SearchResult{
+			GalleryDTO: g.galleryDTO(result.Gallery, wm),
+		}
+		for _, text := range result.Highlights {
+			item.Highlights = append(item.Highlights, highlight(text))
+		}
+		data.Results = append(data.Results, item)
+	}
+	if page > 1 {
+		data.PrevURL = searchPageURL(r.URL.Path, data.Query, page-1)
+	}
+	if more {
+		data.NextURL = searchPageURL(r.URL.Path, data.Query, page+1)
+	}
+	return &data, nil
+}
+
+// Search looks for published galleries.
+func (g Galleries) Search(w http.ResponseWriter, r *http.Request) {
+	data, err := g.search(r, uuid.NullUUID{})
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	g.Templates.Search.Execute(w, r, data)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/AguilaMike/lenslocked/pkg/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type ShareLink struct {
+	ID            uuid.UUID
+	Label         string
+	URL           string
+	ExpiresAt     string
+	AllowDownload bool
+	Views         int
+	Active        bool
+	Revoked       bool
+}
+
+// shareLink resolves the "share" query value into data.ShareLink so that
+// options running after it, such as userMustPrivateGallery, can let the
+// visitor in. Requests without a token are left untouched, and so are those
+// with an expired or revoked token for a private gallery, which the visitor
+// is not told exists.
+func (g Galleries) shareLink(w http.ResponseWriter, r *http.Request, data *GalleryDTO, gallery *models.Gallery) error {
+	token := r.URL.Query().Get("share")
+	if token == "" {
+		return nil
+	}
+	link, err := g.ShareLinkService.Valid(gallery.ID, token)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			if !gallery.Public {
+				return nil
+			}
+			http.Error(w, "This share link has expired or was revoked", http.StatusForbidden)
+			return err
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return err
+	}
+	data.ShareLink = link
+	return nil
+}
+
+func shareLinkDTOs(galleryPath string, links []models.ShareLink) []ShareLink {
+	var result []ShareLink
+	for _, link := range links {
+		item := ShareLink{
+			ID:            link.ID,
+			Label:         link.Label,
+			URL:           fmt.Sprintf("%s?%s", galleryPath, url.Values{"share": {link.Token}}.Encode()),
+			AllowDownload: link.AllowDownload,
+			Views:         link.Views,
+			Active:        link.Active(),
+			Revoked:       link.RevokedAt != nil,
+		}
+		if link.ExpiresAt != nil {
+			item.ExpiresAt = time.Unix(*link.ExpiresAt, 0).UTC().Format("2006-01-02")
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// CreateShareLink reads a "label", an optional "expires_at" date (YYYY-MM-DD,
+// the link works until the end of that day) and an "allow_download" checkbox.
+func (g Galleries) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleCoOwner))
+	if !ok {
+		return
+	}
+	var expiresAt *int64
+	if value := r.FormValue("expires_at"); value != "" {
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid expiry date", http.StatusBadRequest)
+			return
+		}
+		unix := day.Add(24*time.Hour - time.Second).Unix()
+		expiresAt = &unix
+	}
+	label := strings.TrimSpace(r.FormValue("label"))
+	allowDownload := utils.ConvertBoolCheckbox(r.FormValue("allow_download"))
+	_, err := g.ShareLinkService.Create(gallery.ID, label, allowDownload, expiresAt)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleCoOwner))
+	if !ok {
+		return
+	}
+	linkID, err := uuid.Parse(chi.URLParam(r, "linkID"))
+	if err != nil {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+	err = g.ShareLinkService.Revoke(gallery.ID, linkID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", data.Path)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/AguilaMike/lenslocked/pkg/internal/sitemap"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// sitemapGalleries is the number of galleries listed per sitemap, each
+	// with its images.
+	sitemapGalleries = 1000
+	// sitemapCacheAge is how long, in seconds, crawlers may keep the sitemap.
+	sitemapCacheAge = 3600
+)
+
+// indexable reports whether search engines may list the pages of a gallery.
+func indexable(gallery *models.Gallery) bool {
+	return gallery.Public && !gallery.NoIndex
+}
+
+// setRobotsTag asks search engines not to list the response when it shows a
+// gallery that is private or marked as noindex.
+func setRobotsTag(w http.ResponseWriter, gallery *models.Gallery) {
+	if !indexable(gallery) {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+}
+
+// SitemapIndex lists the sitemaps of the public galleries search engines may
+// crawl, sitemapGalleries per sitemap, and of the profiles of their owners.
+func (g Galleries) SitemapIndex(w http.ResponseWriter, r *http.Request) {
+	galleries, owners, err := g.GalleryService.CountIndexable()
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	var index sitemap.Index
+	for page := 1; page == 1 || (page-1)*sitemapGalleries < galleries; page++ {
+		index.Sitemaps = append(index.Sitemaps, fmt.Sprintf("%s/sitemap-galleries-%d.xml", g.BaseURL, page))
+	}
+	for page := 1; (page-1)*sitemap.MaxURLs < owners; page++ {
+		index.Sitemaps = append(index.Sitemaps, fmt.Sprintf("%s/sitemap-profiles-%d.xml", g.BaseURL, page))
+	}
+	writeSitemap(w, index)
+}
+
+// sitemapPage reads the number of the sitemap asked for from the "page" URL
+// parameter, starting at 1.
+func sitemapPage(w http.ResponseWriter, r *http.Request) (int, bool) {
+	page, err := strconv.Atoi(chi.URLParam(r, "page"))
+	if err != nil || page < 1 {
+		http.Error(w, "Sitemap not found", http.StatusNotFound)
+		return 0, false
+	}
+	return page, true
+}
+
+// GalleriesSitemap lists a page of the public galleries search engines may
+// crawl, with their images.
+func (g Galleries) GalleriesSitemap(w http.ResponseWriter, r *http.Request) {
+	page, ok := sitemapPage(w, r)
+	if !ok {
+		return
+	}
+	galleries, err := g.GalleryService.Indexable((page-1)*sitemapGalleries, sitemapGalleries)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	ids := make([]uuid.UUID, len(galleries))
+	for i, gallery := range galleries {
+		ids[i] = gallery.ID
+	}
+	images, err := g.GalleryService.ImagesByGalleryIDs(ids, sitemap.MaxImages)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	var sm sitemap.Sitemap
+	watermarks := map[uuid.UUID]*models.Watermark{}
+	for _, gallery := range galleries {
+		wm, ok := watermarks[gallery.UserID]
+		if !ok {
+			wm, err = g.visitorWatermark(gallery.UserID, false)
+			if err != nil {
+				fmt.Println(err)
+				http.Error(w, "Something went wrong", http.StatusInternalServerError)
+				return
+			}
+			watermarks[gallery.UserID] = wm
+		}
+		item := sitemap.URL{
+			Loc:     g.BaseURL + galleryPath(&gallery),
+			LastMod: unixTime(gallery.UpdatedAt),
+		}
+		if item.LastMod.IsZero() {
+			item.LastMod = unixTime(&gallery.CreatedAt)
+		}
+		for _, image := range images[gallery.ID] {
+			// Crawlers come back long after, so the URLs are not signed.
+			item.Images = append(item.Images, g.BaseURL+publicImagePath(galleryPath(&gallery), image.ID, image.Version(wm.Version())))
+		}
+		sm.URLs = append(sm.URLs, item)
+	}
+	writeSitemap(w, sm)
+}
+
+// ProfilesSitemap lists a page of the profiles of the owners of the public
+// galleries search engines may crawl.
+func (g Galleries) ProfilesSitemap(w http.ResponseWriter, r *http.Request) {
+	page, ok := sitemapPage(w, r)
+	if !ok {
+		return
+	}
+	owners, err := g.GalleryService.IndexableOwners((page-1)*sitemap.MaxURLs, sitemap.MaxURLs)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	var sm sitemap.Sitemap
+	for _, owner := range owners {
+		sm.URLs = append(sm.URLs, sitemap.URL{
+			Loc:     fmt.Sprintf("%s/profiles/%s", g.BaseURL, owner.UserID),
+			LastMod: unixTime(&owner.LastMod),
+		})
+	}
+	writeSitemap(w, sm)
+}
+
+// writeSitemap writes a sitemap or sitemap index to the response.
+func writeSitemap(w http.ResponseWriter, sm interface{ Write(io.Writer) error }) {
+	var buf bytes.Buffer
+	err := sm.Write(&buf)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", sitemap.ContentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", sitemapCacheAge))
+	w.Write(buf.Bytes())
+}
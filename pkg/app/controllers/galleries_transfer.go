@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/google/uuid"
+)
+
+// GalleryOption is another gallery images can be copied, moved or merged
+// into, as listed in forms.
+type GalleryOption struct {
+	ID    uuid.UUID
+	Title string
+}
+
+// transferOptions sets the galleries that the images of the gallery can be
+// copied or moved to, and the galleries that can be merged into it.
+func (g Galleries) transferOptions(data *GalleryDTO, gallery *models.Gallery) error {
+	galleries, err := g.GalleryService.EditableByUserID(data.UserID)
+	if err != nil {
+		return err
+	}
+	for _, other := range galleries {
+		if other.ID == gallery.ID {
+			continue
+		}
+		option := GalleryOption{ID: other.ID, Title: other.Title}
+		data.TransferTargets = append(data.TransferTargets, option)
+		if data.Role == models.RoleOwner && other.UserID == gallery.UserID {
+			data.MergeSources = append(data.MergeSources, option)
+		}
+	}
+	return nil
+}
+
+// otherGallery finds the gallery picked in the "gallery" form value and
+// checks that the user has at least role in it.
+func (g Galleries) otherGallery(w http.ResponseWriter, r *http.Request, role models.GalleryRole) (*models.Gallery, bool) {
+	id, err := uuid.Parse(r.FormValue("gallery"))
+	if err != nil {
+		http.Error(w, "Gallery not found", http.StatusNotFound)
+		return nil, false
+	}
+	gallery, err := g.GalleryService.ByID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Gallery not found", http.StatusNotFound)
+			return nil, false
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return nil, false
+	}
+	var data GalleryDTO
+	return gallery, g.check(w, r, &data, gallery, g.userMustHaveRole(role))
+}
+
+// transferRedirect goes to the edit page of the gallery the images were
+// added to, listing the images that were skipped or renamed.
+func transferRedirect(w http.ResponseWriter, r *http.Request, gallery *models.Gallery, transfer *models.Transfer) {
+	query := url.Values{}
+	for _, name := range transfer.Skipped {
+		query.Add("skipped", name)
+	}
+	for _, name := range transfer.Renamed {
+		query.Add("renamed", name)
+	}
+	editPath := fmt.Sprintf("%s/edit", galleryPath(gallery))
+	if len(query) > 0 {
+		editPath += "?" + query.Encode()
+	}
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+// Duplicate copies the gallery and goes to the edit page of the copy.
+func (g Galleries) Duplicate(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleOwner))
+	if !ok {
+		return
+	}
+	duplicate, err := g.GalleryService.Duplicate(gallery)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	editPath := fmt.Sprintf("%s/edit", galleryPath(duplicate))
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+// TransferImages copies or moves the images selected in the "image_id" form
+// values to the gallery in the "gallery" form value, depending on whether
+// the "action" form value is "copy" or "move". The user must be able to edit
+// both galleries.
+func (g Galleries) TransferImages(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleEditor))
+	if !ok {
+		return
+	}
+	r.ParseForm()
+	dst, ok := g.otherGallery(w, r, models.RoleEditor)
+	if !ok {
+		return
+	}
+	var imageIDs []uuid.UUID
+	for _, value := range r.Form["image_id"] {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			continue
+		}
+		imageIDs = append(imageIDs, id)
+	}
+	var transfer *models.Transfer
+	var err error
+	switch r.FormValue("action") {
+	case "copy":
+		transfer, err = g.GalleryService.CopyImages(gallery, dst, imageIDs)
+	case "move":
+		transfer, err = g.GalleryService.MoveImages(gallery, dst, imageIDs)
+	default:
+		http.Error(w, "Please choose to copy or move the images.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	transferRedirect(w, r, dst, transfer)
+}
+
+// Merge moves the images of the gallery in the "gallery" form value into
+// this one and moves the other gallery to the trash. The user must own both
+// galleries.
+func (g Galleries) Merge(w http.ResponseWriter, r *http.Request) {
+	var data GalleryDTO
+	gallery, ok := g.validate(w, r, &data, g.userMustHaveRole(models.RoleOwner))
+	if !ok {
+		return
+	}
+	r.ParseForm()
+	src, ok := g.otherGallery(w, r, models.RoleOwner)
+	if !ok {
+		return
+	}
+	transfer, err := g.GalleryService.Merge(gallery, src)
+	if err != nil {
+		visitorError(w, err)
+		return
+	}
+	transferRedirect(w, r, gallery, transfer)
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// slideshowIntervals are the autoplay intervals, in seconds, offered by the
+// image viewer.
+var slideshowIntervals = []int{3, 5, 10}
+
+const (
+	// defaultSlideshowInterval is the autoplay interval, in seconds, of
+	// slideshows started from a link.
+	defaultSlideshowInterval = 5
+	// maxSlideshowInterval is the longest autoplay interval, in seconds.
+	maxSlideshowInterval = 60
+)
+
+// Slide is an image of the gallery as the viewer script navigates to it.
+type Slide struct {
+	Page    string `json:"page"`
+	URL     string `json:"url"`
+	AltText string `json:"alt"`
+	Caption string `json:"caption"`
+}
+
+// imagePagePath returns the path of the viewer page of the n-th image of the
+// gallery, counting from 1. The slideshow plays every autoplay seconds when
+// autoplay is not 0.
+func imagePagePath(data GalleryDTO, n, autoplay int) string {
+	path := fmt.Sprintf("%s/images/%d", data.Path, n)
+	query := url.Values{}
+	if data.ShareLink != nil {
+		query.Set("share", data.ShareLink.Token)
+	}
+	if autoplay > 0 {
+		query.Set("autoplay", strconv.Itoa(autoplay))
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path
+}
+
+// slideshowInterval reads the "autoplay" query value of r, or 0 when the
+// slideshow is paused.
+func slideshowInterval(r *http.Request) int {
+	autoplay, err := strconv.Atoi(r.URL.Query().Get("autoplay"))
+	if err != nil || autoplay < 1 {
+		return 0
+	}
+	return min(autoplay, maxSlideshowInterval)
+}
+
+// ShowImage is the viewer page of the image at the "n" URL param, counting
+// from 1, with links to the previous and next images. The page works on its
+// own and is enhanced by a script for keyboard and swipe navigation. When
+// the "autoplay" query value is set the slideshow moves on to the next image
+// every that many seconds, by reloading the page when scripts are disabled.
+func (g Galleries) ShowImage(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		GalleryDTO
+		Image  Image
+		Number int
+		Count  int
+		// Autoplay is the interval of the slideshow when it plays, and
+		// Interval the one picked in the form.
+		Autoplay int
+		Interval int
+		// PlayURL starts the slideshow from this image, and PauseURL stops
+		// it.
+		PlayURL  string
+		PauseURL string
+		// RefreshURL is the page the slideshow moves on to when scripts are
+		// disabled.
+		RefreshURL string
+		PrevURL    string
+		NextURL    string
+		GalleryURL string
+		// Prefetch are the neighbouring images, loaded ahead of time.
+		Prefetch  []string
+		Slides    []Slide
+		Intervals []int
+	}
+	gallery, ok := g.validate(w, r, &data.GalleryDTO, g.galleryMember, g.shareLink, userMustPrivateGallery)
+	if !ok {
+		return
+	}
+	data.Title = gallery.Title
+	images, err := g.GalleryService.Images(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil || n < 1 || n > len(images) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	wm, err := g.visitorWatermark(gallery.UserID, data.Role != "")
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	dtos := g.imageDTOs(gallery, images, wm)
+	for i, image := range dtos {
+		data.Slides = append(data.Slides, Slide{
+			Page:    imagePagePath(data.GalleryDTO, i+1, 0),
+			URL:     image.URL,
+			AltText: image.AltText,
+			Caption: image.Caption,
+		})
+	}
+	data.Image = dtos[n-1]
+	data.Meta = g.imageMeta(gallery, images[n-1], n, len(dtos), wm)
+	setRobotsTag(w, gallery)
+	// Image files are also fetched for thumbnails, prefetching, embeds and
+	// feeds, so views are counted on the page of the image.
+	if data.Role == "" {
+		g.recordView(r, gallery.ID, uuid.NullUUID{UUID: images[n-1].ID, Valid: true}, models.ViewImage)
+	}
+	data.Number = n
+	data.Count = len(dtos)
+	data.Autoplay = slideshowInterval(r)
+	data.Interval = data.Autoplay
+	if data.Interval == 0 {
+		data.Interval = defaultSlideshowInterval
+	}
+	data.Intervals = slideshowIntervals
+	data.PlayURL = imagePagePath(data.GalleryDTO, n, defaultSlideshowInterval)
+	data.PauseURL = imagePagePath(data.GalleryDTO, n, 0)
+	data.GalleryURL = fmt.Sprintf("%s%s#image-%s", data.Path, data.ShareQuery(), data.Image.ID)
+	if n > 1 {
+		data.PrevURL = imagePagePath(data.GalleryDTO, n-1, data.Autoplay)
+		data.Prefetch = append(data.Prefetch, dtos[n-2].URL)
+	}
+	if n < len(dtos) {
+		data.NextURL = imagePagePath(data.GalleryDTO, n+1, data.Autoplay)
+		data.Prefetch = append(data.Prefetch, dtos[n].URL)
+	}
+	if data.Autoplay > 0 {
+		// The slideshow starts over once it reaches the end.
+		next := n%len(dtos) + 1
+		data.RefreshURL = imagePagePath(data.GalleryDTO, next, data.Autoplay)
+	}
+	g.Templates.Image.Execute(w, r, data)
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// immutableMaxAge is how long responses to versioned URLs, whose content
+// never changes, are cached.
+const immutableMaxAge = 365 * 24 * time.Hour
+
+// imageCacheControl returns the Cache-Control header of an image. Signed URLs
+// can be kept by shared caches such as CDNs, but only until they expire, as
+// they grant access to the image. Other URLs depend on the session or share
+// link of the visitor, so only their browser keeps them. Versioned URLs are
+// immutable, the others must be revalidated.
+func imageCacheControl(expires time.Time, signed, versioned bool) string {
+	var value string
+	switch {
+	case signed:
+		value = fmt.Sprintf("public, max-age=%d", int(time.Until(expires).Seconds()))
+	case versioned:
+		value = fmt.Sprintf("private, max-age=%d", int(immutableMaxAge.Seconds()))
+	default:
+		return "private, no-cache"
+	}
+	if versioned {
+		value += ", immutable"
+	}
+	return value
+}
+
+// etagMatches reports whether the If-None-Match header of r lists etag, a
+// quoted strong ETag.
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		// If-None-Match uses the weak comparison.
+		value = strings.TrimPrefix(value, "W/")
+		if value == "*" || value == etag {
+			return true
+		}
+	}
+	return false
+}
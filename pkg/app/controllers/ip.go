@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ProxyMiddleware sets the remote address of requests forwarded by the
+// proxies in front of the server to the address of their client.
+type ProxyMiddleware struct {
+	// TrustedProxies are the networks of those proxies. X-Forwarded-For is
+	// ignored on requests from anywhere else, as clients can set it.
+	TrustedProxies []*net.IPNet
+}
+
+func (pmw ProxyMiddleware) trusted(ip net.IP) bool {
+	for _, network := range pmw.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetClientIP replaces the remote address of requests from trusted proxies
+// with the one they forwarded.
+func (pmw ProxyMiddleware) SetClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !pmw.trusted(net.ParseIP(host)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Every proxy appends the address it got the request from, so the
+		// client is the last address that is not one of our proxies.
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+			if ip == nil {
+				break
+			}
+			r.RemoteAddr = net.JoinHostPort(ip.String(), port)
+			if !pmw.trusted(ip) {
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the ip address from the http request. Behind proxies it
+// relies on ProxyMiddleware to have set the address of the client.
+func ClientIP(r *http.Request) (string, error) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+
+	netIP := net.ParseIP(ip)
+	if netIP != nil {
+		ip := netIP.String()
+		if ip == "::1" {
+			return "127.0.0.1", nil
+		}
+		return ip, nil
+	}
+
+	return "", errors.New("IP not found")
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+)
+
+// Pagination links to the pages around the listed one, if any.
+type Pagination struct {
+	PrevURL string
+	NextURL string
+}
+
+// pageRequest reads the page asked for from the "cursor" query value. Invalid
+// cursors fall back to the first page.
+func pageRequest(r *http.Request) models.PageRequest {
+	var page models.PageRequest
+	page.Cursor, _ = models.DecodeCursor(r.URL.Query().Get("cursor"))
+	return page
+}
+
+// pagination links to the pages of info, keeping the other query values of
+// the request.
+func pagination(r *http.Request, info models.PageInfo) Pagination {
+	return Pagination{
+		PrevURL: cursorURL(r.URL, info.Prev),
+		NextURL: cursorURL(r.URL, info.Next),
+	}
+}
+
+func cursorURL(u *url.URL, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	values := u.Query()
+	values.Set("cursor", cursor)
+	return u.Path + "?" + values.Encode()
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultRobotsDisallow are the paths crawlers are asked to skip, pages that
+// only make sense for signed in users or are no content of their own.
+var DefaultRobotsDisallow = []string{
+	"/signin",
+	"/signup",
+	"/forgot-pw",
+	"/reset-pw",
+	"/users/",
+	"/invitations",
+	"/transfers",
+	"/search",
+	"/oembed",
+}
+
+// Robots serves the robots.txt of the site, asking all crawlers to skip the
+// disallowed paths and pointing them to the sitemap.
+func Robots(baseURL string, disallow []string) http.HandlerFunc {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if len(disallow) == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	for _, path := range disallow {
+		fmt.Fprintf(&b, "Disallow: %s\n", path)
+	}
+	fmt.Fprintf(&b, "\nSitemap: %s/sitemap.xml\n", baseURL)
+	robots := b.String()
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, robots)
+	}
+}
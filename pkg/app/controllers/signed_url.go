@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultImageURLTTL is how long a signed image URL stays valid when the
+	// signer does not set its own TTL.
+	DefaultImageURLTTL = 6 * time.Hour
+)
+
+// ImageURLSigner creates image URLs that carry their own authorization, an
+// HMAC over the gallery, the image and an expiry time. Anyone holding such a
+// URL can load the image until it expires, without a session or share link.
+type ImageURLSigner struct {
+	Key []byte
+	// TTL is the minimum time a signed URL stays valid. Expiry times are
+	// rounded up to a multiple of TTL so a page renders the same URLs for a
+	// while, which keeps both the pages and the images cacheable.
+	TTL time.Duration
+}
+
+func (s ImageURLSigner) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return DefaultImageURLTTL
+	}
+	return s.TTL
+}
+
+// URL returns the signed URL of an image, in the gallery at galleryPath with
+// galleryID. Without a key the plain URL is returned, and visitors need the
+// usual access to the gallery instead. Signatures are made over the gallery
+// ID, so URLs keep working after the gallery is renamed.
+//
+// Clean URLs serve the image without the watermark of the gallery owner, and
+// are only meant for pages shown to the owner and members of the gallery.
+//
+// The version of the image (see models.Image.Version) is added to the URL, so
+// that the URL changes whenever the image does and can be cached for good.
+func (s ImageURLSigner) URL(galleryPath string, galleryID, imageID uuid.UUID, version string, clean bool) string {
+	if len(s.Key) == 0 {
+		return publicImagePath(galleryPath, imageID, version)
+	}
+	path := fmt.Sprintf("%s/images/%s", galleryPath, imageID)
+	ttl := int64(s.ttl().Seconds())
+	expires := (time.Now().Unix()/ttl + 2) * ttl
+	vals := url.Values{
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {s.signature(galleryID, imageID, expires, clean)},
+	}
+	if clean {
+		vals.Set("clean", "1")
+	}
+	if version != "" {
+		vals.Set("v", version)
+	}
+	return path + "?" + vals.Encode()
+}
+
+// publicImagePath returns the unsigned path of an image, for visitors with
+// the usual access to the gallery.
+func publicImagePath(galleryPath string, imageID uuid.UUID, version string) string {
+	path := fmt.Sprintf("%s/images/%s", galleryPath, imageID)
+	if version != "" {
+		path += "?" + url.Values{"v": {version}}.Encode()
+	}
+	return path
+}
+
+// Verify checks the "expires", "sig" and "clean" values of a signed URL. It
+// returns the expiry time when they are valid.
+func (s ImageURLSigner) Verify(galleryID, imageID uuid.UUID, vals url.Values) (time.Time, bool) {
+	if len(s.Key) == 0 {
+		return time.Time{}, false
+	}
+	expires, err := strconv.ParseInt(vals.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return time.Time{}, false
+	}
+	expected := s.signature(galleryID, imageID, expires, vals.Get("clean") == "1")
+	if !hmac.Equal([]byte(expected), []byte(vals.Get("sig"))) {
+		return time.Time{}, false
+	}
+	return time.Unix(expires, 0), true
+}
+
+func (s ImageURLSigner) signature(galleryID, imageID uuid.UUID, expires int64, clean bool) string {
+	mac := hmac.New(sha256.New, s.Key)
+	fmt.Fprintf(mac, "%s:%s:%d", galleryID, imageID, expires)
+	if clean {
+		fmt.Fprint(mac, ":clean")
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
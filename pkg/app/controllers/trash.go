@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/context"
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Trash lets users restore the galleries and images they deleted, or delete
+// them for good before they are purged.
+type Trash struct {
+	Templates struct {
+		Index Template
+	}
+	GalleryService *models.GalleryService
+}
+
+type TrashedGallery struct {
+	ID        uuid.UUID
+	Title     string
+	DeletedAt string
+	ExpiresAt string
+}
+
+type TrashedImage struct {
+	ID           uuid.UUID
+	Filename     string
+	GalleryTitle string
+	DeletedAt    string
+	ExpiresAt    string
+}
+
+func formatTrashTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04")
+}
+
+// Index lists the galleries and images in the trash of the user.
+func (t Trash) Index(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Galleries []TrashedGallery
+		Images    []TrashedImage
+	}
+	trash, err := t.GalleryService.Trash(context.User(r.Context()).ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	for _, gallery := range trash.Galleries {
+		data.Galleries = append(data.Galleries, TrashedGallery{
+			ID:        gallery.ID,
+			Title:     gallery.Title,
+			DeletedAt: formatTrashTime(gallery.DeletedAt),
+			ExpiresAt: formatTrashTime(gallery.ExpiresAt),
+		})
+	}
+	for _, image := range trash.Images {
+		data.Images = append(data.Images, TrashedImage{
+			ID:           image.ID,
+			Filename:     image.Filename,
+			GalleryTitle: image.GalleryTitle,
+			DeletedAt:    formatTrashTime(image.DeletedAt),
+			ExpiresAt:    formatTrashTime(image.ExpiresAt),
+		})
+	}
+	t.Templates.Index.Execute(w, r, data)
+}
+
+func (t Trash) RestoreGallery(w http.ResponseWriter, r *http.Request) {
+	t.apply(w, r, t.GalleryService.RestoreGallery)
+}
+
+func (t Trash) PurgeGallery(w http.ResponseWriter, r *http.Request) {
+	t.apply(w, r, t.GalleryService.PurgeGallery)
+}
+
+func (t Trash) RestoreImage(w http.ResponseWriter, r *http.Request) {
+	t.apply(w, r, t.GalleryService.RestoreImage)
+}
+
+func (t Trash) PurgeImage(w http.ResponseWriter, r *http.Request) {
+	t.apply(w, r, t.GalleryService.PurgeImage)
+}
+
+// apply runs action on the item of the trash in the "id" URL parameter, on
+// behalf of the user, and goes back to the trash.
+func (t Trash) apply(w http.ResponseWriter, r *http.Request, action func(userID, id uuid.UUID) error) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	err = action(context.User(r.Context()).ID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/trash", http.StatusFound)
+}
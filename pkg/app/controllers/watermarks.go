@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/context"
+	"github.com/AguilaMike/lenslocked/pkg/app/models"
+	"github.com/AguilaMike/lenslocked/pkg/internal/utils"
+)
+
+// Watermarks lets users set up the watermark drawn on the images that
+// visitors of their galleries see.
+type Watermarks struct {
+	Templates struct {
+		Edit Template
+	}
+	WatermarkService *models.WatermarkService
+}
+
+type watermarkData struct {
+	Enabled   bool
+	Text      string
+	HasLogo   bool
+	Position  models.WatermarkPosition
+	Positions []models.WatermarkPosition
+	Opacity   int
+	Scale     int
+}
+
+func (wc Watermarks) render(w http.ResponseWriter, r *http.Request, wm *models.Watermark, errs ...error) {
+	data := watermarkData{
+		Enabled:   wm.Enabled,
+		Text:      wm.Text,
+		HasLogo:   wm.LogoChecksum != "",
+		Position:  wm.Position,
+		Positions: models.WatermarkPositions,
+		Opacity:   wm.Opacity,
+		Scale:     wm.Scale,
+	}
+	wc.Templates.Edit.Execute(w, r, data, errs...)
+}
+
+// Edit shows the watermark settings of the user.
+func (wc Watermarks) Edit(w http.ResponseWriter, r *http.Request) {
+	wm, err := wc.WatermarkService.ByUserID(context.User(r.Context()).ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	wc.render(w, r, wm)
+}
+
+// Update saves the watermark settings of the user.
+func (wc Watermarks) Update(w http.ResponseWriter, r *http.Request) {
+	wm, err := wc.WatermarkService.ByUserID(context.User(r.Context()).ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	wm.Enabled = utils.ConvertBoolCheckbox(r.FormValue("enabled"))
+	wm.Text = r.FormValue("text")
+	wm.Position = models.WatermarkPosition(r.FormValue("position"))
+	opacity, err := strconv.Atoi(r.FormValue("opacity"))
+	if err != nil {
+		opacity = -1
+	}
+	wm.Opacity = opacity
+	scale, err := strconv.Atoi(r.FormValue("scale"))
+	if err != nil {
+		scale = 0
+	}
+	wm.Scale = scale
+	err = wc.WatermarkService.Update(wm)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidWatermark) {
+			wc.render(w, r, wm, err)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/watermark", http.StatusFound)
+}
+
+// UploadLogo replaces the logo of the watermark with the PNG file in the
+// "logo" form value.
+func (wc Watermarks) UploadLogo(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(5 << 20) // 5mb
+	if err != nil {
+		http.Error(w, "The logo must be a PNG file of at most 5mb.", http.StatusBadRequest)
+		return
+	}
+	file, _, err := r.FormFile("logo")
+	if err != nil {
+		http.Error(w, "Please choose a PNG file.", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	err = wc.WatermarkService.SetLogo(context.User(r.Context()).ID, file)
+	if err != nil {
+		var fileErr models.FileError
+		if errors.As(err, &fileErr) {
+			http.Error(w, "The logo must be a valid PNG file.", http.StatusBadRequest)
+			return
+		}
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/watermark", http.StatusFound)
+}
+
+// RemoveLogo makes the watermark use its text again.
+func (wc Watermarks) RemoveLogo(w http.ResponseWriter, r *http.Request) {
+	err := wc.WatermarkService.RemoveLogo(context.User(r.Context()).ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/watermark", http.StatusFound)
+}
+
+// Logo serves the logo of the watermark of the user.
+func (wc Watermarks) Logo(w http.ResponseWriter, r *http.Request) {
+	wm, err := wc.WatermarkService.ByUserID(context.User(r.Context()).ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	path, err := wc.WatermarkService.Logo(wm)
+	if err != nil {
+		http.Error(w, "Logo not found", http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1 @@
+ALTER TABLE galleries DROP COLUMN allow_download;
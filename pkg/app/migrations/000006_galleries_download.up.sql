@@ -0,0 +1 @@
+ALTER TABLE galleries ADD COLUMN allow_download boolean NOT NULL DEFAULT false;
@@ -0,0 +1,15 @@
+CREATE TABLE images (
+  id UUID NOT NULL,
+  gallery_id UUID NOT NULL,
+  filename TEXT NOT NULL,
+  checksum TEXT NOT NULL,
+  extension TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT images_id_pk PRIMARY KEY (id),
+  CONSTRAINT images_gallery_id_checksum_uq UNIQUE (gallery_id, checksum),
+  CONSTRAINT rel_images_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_images_gallery_id ON images (gallery_id);
@@ -0,0 +1,6 @@
+DROP INDEX idx_images_gallery_id_position;
+ALTER TABLE galleries DROP CONSTRAINT rel_galleries_images_cover_image_id;
+ALTER TABLE galleries DROP COLUMN cover_image_id;
+ALTER TABLE images DROP COLUMN alt_text;
+ALTER TABLE images DROP COLUMN caption;
+ALTER TABLE images DROP COLUMN position;
@@ -0,0 +1,7 @@
+ALTER TABLE images ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN caption TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN alt_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE galleries ADD COLUMN cover_image_id UUID;
+ALTER TABLE galleries ADD CONSTRAINT rel_galleries_images_cover_image_id FOREIGN KEY (cover_image_id) REFERENCES images (id) ON DELETE SET NULL;
+
+CREATE INDEX idx_images_gallery_id_position ON images (gallery_id, position);
@@ -0,0 +1 @@
+DROP TABLE gallery_share_links;
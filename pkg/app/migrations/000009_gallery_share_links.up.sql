@@ -0,0 +1,17 @@
+CREATE TABLE gallery_share_links (
+  id UUID NOT NULL,
+  gallery_id UUID NOT NULL,
+  token TEXT NOT NULL,
+  label TEXT NOT NULL DEFAULT '',
+  allow_download BOOL NOT NULL DEFAULT FALSE,
+  expires_at INTEGER,
+  views INTEGER NOT NULL DEFAULT 0,
+  revoked_at INTEGER,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT gallery_share_links_id_pk PRIMARY KEY (id),
+  CONSTRAINT gallery_share_links_token_uq UNIQUE (token),
+  CONSTRAINT rel_gallery_share_links_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_gallery_share_links_gallery_id ON gallery_share_links (gallery_id);
@@ -0,0 +1 @@
+DROP TABLE gallery_members;
@@ -0,0 +1,22 @@
+CREATE TABLE gallery_members (
+  id UUID NOT NULL,
+  gallery_id UUID NOT NULL,
+  user_id UUID,
+  email TEXT NOT NULL,
+  role TEXT NOT NULL,
+  token_hash TEXT,
+  expires_at INTEGER,
+  invited_by UUID NOT NULL,
+  accepted_at INTEGER,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT gallery_members_id_pk PRIMARY KEY (id),
+  CONSTRAINT gallery_members_gallery_id_email_uq UNIQUE (gallery_id, email),
+  CONSTRAINT gallery_members_token_hash_uq UNIQUE (token_hash),
+  CONSTRAINT gallery_members_role_ck CHECK (role IN ('viewer', 'contributor', 'editor', 'co-owner')),
+  CONSTRAINT rel_gallery_members_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE,
+  CONSTRAINT rel_gallery_members_users_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_gallery_members_gallery_id ON gallery_members (gallery_id);
+CREATE INDEX idx_gallery_members_user_id ON gallery_members (user_id);
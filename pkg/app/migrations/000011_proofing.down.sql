@@ -0,0 +1,4 @@
+DROP TABLE proofing_picks;
+DROP TABLE proofing_selections;
+ALTER TABLE galleries DROP COLUMN selection_limit;
+ALTER TABLE galleries DROP COLUMN proofing_enabled;
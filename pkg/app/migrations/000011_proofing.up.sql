@@ -0,0 +1,31 @@
+ALTER TABLE galleries ADD COLUMN proofing_enabled BOOL NOT NULL DEFAULT FALSE;
+ALTER TABLE galleries ADD COLUMN selection_limit INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE proofing_selections (
+  id UUID NOT NULL,
+  gallery_id UUID NOT NULL,
+  share_link_id UUID,
+  token_hash TEXT NOT NULL,
+  client_name TEXT NOT NULL DEFAULT '',
+  client_email TEXT NOT NULL DEFAULT '',
+  submitted_at INTEGER,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT proofing_selections_id_pk PRIMARY KEY (id),
+  CONSTRAINT proofing_selections_token_hash_uq UNIQUE (token_hash),
+  CONSTRAINT rel_proofing_selections_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE,
+  CONSTRAINT rel_proofing_selections_gallery_share_links_id FOREIGN KEY (share_link_id) REFERENCES gallery_share_links (id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_proofing_selections_gallery_id ON proofing_selections (gallery_id);
+
+CREATE TABLE proofing_picks (
+  selection_id UUID NOT NULL,
+  image_id UUID NOT NULL,
+  note TEXT NOT NULL DEFAULT '',
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT proofing_picks_pk PRIMARY KEY (selection_id, image_id),
+  CONSTRAINT rel_proofing_picks_proofing_selections_id FOREIGN KEY (selection_id) REFERENCES proofing_selections (id) ON DELETE CASCADE,
+  CONSTRAINT rel_proofing_picks_images_id FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
+);
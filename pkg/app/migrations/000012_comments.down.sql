@@ -0,0 +1,2 @@
+DROP TABLE comments;
+ALTER TABLE galleries DROP COLUMN comments_enabled;
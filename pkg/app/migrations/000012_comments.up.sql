@@ -0,0 +1,28 @@
+-- Comments stay off on existing galleries until their owner turns them on.
+ALTER TABLE galleries ADD COLUMN comments_enabled BOOL NOT NULL DEFAULT FALSE;
+ALTER TABLE galleries ALTER COLUMN comments_enabled SET DEFAULT TRUE;
+
+CREATE TABLE comments (
+  id UUID NOT NULL,
+  gallery_id UUID NOT NULL,
+  image_id UUID,
+  parent_id UUID,
+  user_id UUID,
+  author_name TEXT NOT NULL,
+  author_email TEXT NOT NULL DEFAULT '',
+  body TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  ip_hash TEXT NOT NULL DEFAULT '',
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT comments_id_pk PRIMARY KEY (id),
+  CONSTRAINT comments_status_ck CHECK (status IN ('pending', 'approved', 'hidden')),
+  CONSTRAINT rel_comments_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE,
+  CONSTRAINT rel_comments_images_id FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE,
+  CONSTRAINT rel_comments_comments_id FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE,
+  CONSTRAINT rel_comments_users_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_comments_gallery_id ON comments (gallery_id);
+CREATE INDEX idx_comments_user_id ON comments (user_id);
+CREATE INDEX idx_comments_ip_hash ON comments (ip_hash);
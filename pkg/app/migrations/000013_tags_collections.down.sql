@@ -0,0 +1,5 @@
+DROP TABLE collection_galleries;
+DROP TABLE collections;
+DROP TABLE image_tags;
+DROP TABLE gallery_tags;
+DROP TABLE tags;
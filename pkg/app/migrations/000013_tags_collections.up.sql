@@ -0,0 +1,57 @@
+CREATE TABLE tags (
+  id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  name TEXT NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT tags_id_pk PRIMARY KEY (id),
+  CONSTRAINT tags_user_id_name_uq UNIQUE (user_id, name),
+  CONSTRAINT rel_tags_users_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE gallery_tags (
+  gallery_id UUID NOT NULL,
+  tag_id UUID NOT NULL,
+  CONSTRAINT gallery_tags_pk PRIMARY KEY (gallery_id, tag_id),
+  CONSTRAINT rel_gallery_tags_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE,
+  CONSTRAINT rel_gallery_tags_tags_id FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_gallery_tags_tag_id ON gallery_tags (tag_id);
+
+CREATE TABLE image_tags (
+  image_id UUID NOT NULL,
+  tag_id UUID NOT NULL,
+  CONSTRAINT image_tags_pk PRIMARY KEY (image_id, tag_id),
+  CONSTRAINT rel_image_tags_images_id FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE,
+  CONSTRAINT rel_image_tags_tags_id FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_image_tags_tag_id ON image_tags (tag_id);
+
+CREATE TABLE collections (
+  id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  parent_id UUID,
+  title TEXT NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT collections_id_pk PRIMARY KEY (id),
+  CONSTRAINT rel_collections_users_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  CONSTRAINT rel_collections_collections_id FOREIGN KEY (parent_id) REFERENCES collections (id) ON DELETE SET NULL
+);
+
+-- Top level collections use the user ID in place of the parent, so titles are
+-- unique among siblings.
+CREATE UNIQUE INDEX idx_collections_user_id_parent_id_title ON collections (user_id, COALESCE(parent_id, user_id), title);
+CREATE INDEX idx_collections_parent_id ON collections (parent_id);
+
+CREATE TABLE collection_galleries (
+  collection_id UUID NOT NULL,
+  gallery_id UUID NOT NULL,
+  CONSTRAINT collection_galleries_pk PRIMARY KEY (collection_id, gallery_id),
+  CONSTRAINT rel_collection_galleries_collections_id FOREIGN KEY (collection_id) REFERENCES collections (id) ON DELETE CASCADE,
+  CONSTRAINT rel_collection_galleries_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_collection_galleries_gallery_id ON collection_galleries (gallery_id);
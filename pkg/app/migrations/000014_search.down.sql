@@ -0,0 +1,7 @@
+DROP VIEW search_documents;
+DROP INDEX idx_tags_search_vector;
+DROP INDEX idx_images_search_vector;
+DROP INDEX idx_galleries_search_vector;
+ALTER TABLE tags DROP COLUMN search_vector;
+ALTER TABLE images DROP COLUMN search_vector;
+ALTER TABLE galleries DROP COLUMN search_vector;
@@ -0,0 +1,31 @@
+-- Each searchable table keeps a tsvector of its text fields, weighted by how
+-- much a match says about the gallery: A for titles, B for tags and C for
+-- image texts.
+ALTER TABLE galleries ADD COLUMN search_vector tsvector
+  GENERATED ALWAYS AS (setweight(to_tsvector('simple', title), 'A')) STORED;
+ALTER TABLE images ADD COLUMN search_vector tsvector
+  GENERATED ALWAYS AS (setweight(to_tsvector('simple', translate(filename, '_-.', '   ') || ' ' || caption || ' ' || alt_text), 'C')) STORED;
+ALTER TABLE tags ADD COLUMN search_vector tsvector
+  GENERATED ALWAYS AS (setweight(to_tsvector('simple', name), 'B')) STORED;
+
+CREATE INDEX idx_galleries_search_vector ON galleries USING GIN (search_vector);
+CREATE INDEX idx_images_search_vector ON images USING GIN (search_vector);
+CREATE INDEX idx_tags_search_vector ON tags USING GIN (search_vector);
+
+-- search_documents lists every searchable text with the gallery it leads to.
+-- New text fields become searchable by adding a branch here.
+CREATE VIEW search_documents AS
+  SELECT galleries.id AS gallery_id, 'title' AS field, galleries.title AS body, galleries.search_vector AS document
+  FROM galleries
+  UNION ALL
+  SELECT images.gallery_id, 'image', concat_ws(' ', images.filename, NULLIF(images.caption, '')), images.search_vector
+  FROM images
+  UNION ALL
+  SELECT gallery_tags.gallery_id, 'tag', tags.name, tags.search_vector
+  FROM gallery_tags
+    JOIN tags ON tags.id = gallery_tags.tag_id
+  UNION ALL
+  SELECT images.gallery_id, 'tag', tags.name, tags.search_vector
+  FROM image_tags
+    JOIN tags ON tags.id = image_tags.tag_id
+    JOIN images ON images.id = image_tags.image_id;
@@ -0,0 +1,20 @@
+CREATE OR REPLACE VIEW search_documents AS
+  SELECT galleries.id AS gallery_id, 'title' AS field, galleries.title AS body, galleries.search_vector AS document
+  FROM galleries
+  UNION ALL
+  SELECT images.gallery_id, 'image', concat_ws(' ', images.filename, NULLIF(images.caption, '')), images.search_vector
+  FROM images
+  UNION ALL
+  SELECT gallery_tags.gallery_id, 'tag', tags.name, tags.search_vector
+  FROM gallery_tags
+    JOIN tags ON tags.id = gallery_tags.tag_id
+  UNION ALL
+  SELECT images.gallery_id, 'tag', tags.name, tags.search_vector
+  FROM image_tags
+    JOIN tags ON tags.id = image_tags.tag_id
+    JOIN images ON images.id = image_tags.image_id;
+
+DROP INDEX idx_images_deleted_at;
+DROP INDEX idx_galleries_deleted_at;
+ALTER TABLE images DROP COLUMN deleted_at;
+ALTER TABLE galleries DROP COLUMN deleted_at;
@@ -0,0 +1,27 @@
+-- Deleted galleries and images stay in the trash of the gallery owner, with
+-- the time they were deleted, until they are restored or purged.
+ALTER TABLE galleries ADD COLUMN deleted_at INTEGER;
+ALTER TABLE images ADD COLUMN deleted_at INTEGER;
+
+CREATE INDEX idx_galleries_deleted_at ON galleries (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_images_deleted_at ON images (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Images in the trash are not searchable. Galleries in the trash are left
+-- out by the search query itself.
+CREATE OR REPLACE VIEW search_documents AS
+  SELECT galleries.id AS gallery_id, 'title' AS field, galleries.title AS body, galleries.search_vector AS document
+  FROM galleries
+  UNION ALL
+  SELECT images.gallery_id, 'image', concat_ws(' ', images.filename, NULLIF(images.caption, '')), images.search_vector
+  FROM images
+  WHERE images.deleted_at IS NULL
+  UNION ALL
+  SELECT gallery_tags.gallery_id, 'tag', tags.name, tags.search_vector
+  FROM gallery_tags
+    JOIN tags ON tags.id = gallery_tags.tag_id
+  UNION ALL
+  SELECT images.gallery_id, 'tag', tags.name, tags.search_vector
+  FROM image_tags
+    JOIN tags ON tags.id = image_tags.tag_id
+    JOIN images ON images.id = image_tags.image_id
+  WHERE images.deleted_at IS NULL;
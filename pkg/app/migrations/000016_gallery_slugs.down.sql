@@ -0,0 +1,4 @@
+DROP INDEX idx_gallery_slugs_gallery_id;
+DROP TABLE gallery_slugs;
+ALTER TABLE galleries DROP CONSTRAINT galleries_user_id_slug_uq;
+ALTER TABLE galleries DROP COLUMN slug;
@@ -0,0 +1,44 @@
+-- Galleries are found by the ID of their owner and a slug made from their
+-- title, e.g. /galleries/<user id>/summer-wedding. Slugs are unique among the
+-- galleries of each user, so that they tell nothing about the galleries of
+-- anyone else.
+ALTER TABLE galleries ADD COLUMN slug TEXT;
+
+-- Existing galleries get a slug from their title the way new galleries do.
+-- When titles of a user give the same slug, the oldest gallery keeps it and
+-- the others get the start of their ID appended.
+UPDATE galleries
+SET slug = slugs.slug
+FROM (
+  SELECT id,
+    CASE WHEN row_number() OVER (PARTITION BY user_id, base ORDER BY created_at, id) = 1 THEN base
+      ELSE base || '-' || left(id::text, 8)
+    END AS slug
+  FROM (
+    SELECT id, user_id, created_at,
+      COALESCE(NULLIF(trim(BOTH '-' FROM left(trim(BOTH '-' FROM regexp_replace(
+        translate(lower(title), 'áàâäãåéèêëíìîïóòôöõúùûüñçý', 'aaaaaaeeeeiiiiooooouuuuncy'),
+        '[^a-z0-9]+', '-', 'g')), 60)), ''), 'gallery') AS base
+    FROM galleries
+  ) AS bases
+) AS slugs
+WHERE galleries.id = slugs.id;
+
+ALTER TABLE galleries ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE galleries ADD CONSTRAINT galleries_user_id_slug_uq UNIQUE (user_id, slug);
+
+-- gallery_slugs keeps the former slugs of renamed galleries, along with the
+-- user who owned the gallery then, so that links to them keep working, even
+-- after the gallery changes hands. They are not given to other galleries of
+-- that user.
+CREATE TABLE gallery_slugs (
+  user_id UUID NOT NULL,
+  slug TEXT NOT NULL,
+  gallery_id UUID NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  CONSTRAINT gallery_slugs_user_id_slug_pk PRIMARY KEY (user_id, slug),
+  CONSTRAINT rel_gallery_slugs_users_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  CONSTRAINT rel_gallery_slugs_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_gallery_slugs_gallery_id ON gallery_slugs (gallery_id);
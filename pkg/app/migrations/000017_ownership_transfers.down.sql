@@ -0,0 +1 @@
+DROP TABLE ownership_transfers;
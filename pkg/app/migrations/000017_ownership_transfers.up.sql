@@ -0,0 +1,15 @@
+CREATE TABLE ownership_transfers (
+  id UUID NOT NULL,
+  gallery_id UUID NOT NULL,
+  from_user_id UUID NOT NULL,
+  email TEXT NOT NULL,
+  token_hash TEXT NOT NULL,
+  expires_at INTEGER NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT ownership_transfers_id_pk PRIMARY KEY (id),
+  CONSTRAINT ownership_transfers_gallery_id_uq UNIQUE (gallery_id),
+  CONSTRAINT ownership_transfers_token_hash_uq UNIQUE (token_hash),
+  CONSTRAINT rel_ownership_transfers_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE,
+  CONSTRAINT rel_ownership_transfers_users_id FOREIGN KEY (from_user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,18 @@
+-- Watermarks are drawn on the images of a user when they are served to
+-- visitors. The logo, when set, is used instead of the text.
+CREATE TABLE watermarks (
+  user_id UUID NOT NULL,
+  enabled BOOL NOT NULL DEFAULT FALSE,
+  text TEXT NOT NULL DEFAULT '',
+  logo_checksum TEXT,
+  position TEXT NOT NULL DEFAULT 'bottom-right',
+  opacity INTEGER NOT NULL DEFAULT 50,
+  scale INTEGER NOT NULL DEFAULT 20,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  updated_at INTEGER,
+  CONSTRAINT watermarks_user_id_pk PRIMARY KEY (user_id),
+  CONSTRAINT watermarks_position_ck CHECK (position IN ('top-left', 'top-right', 'center', 'bottom-left', 'bottom-right', 'tile')),
+  CONSTRAINT watermarks_opacity_ck CHECK (opacity BETWEEN 0 AND 100),
+  CONSTRAINT watermarks_scale_ck CHECK (scale BETWEEN 1 AND 100),
+  CONSTRAINT rel_watermarks_users_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
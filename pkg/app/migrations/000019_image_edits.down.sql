@@ -0,0 +1,9 @@
+ALTER TABLE images DROP CONSTRAINT images_crop_ck;
+ALTER TABLE images DROP CONSTRAINT images_rotation_ck;
+ALTER TABLE images DROP COLUMN crop_bottom;
+ALTER TABLE images DROP COLUMN crop_right;
+ALTER TABLE images DROP COLUMN crop_top;
+ALTER TABLE images DROP COLUMN crop_left;
+ALTER TABLE images DROP COLUMN flip_vertical;
+ALTER TABLE images DROP COLUMN flip_horizontal;
+ALTER TABLE images DROP COLUMN rotation;
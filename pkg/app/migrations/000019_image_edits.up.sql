@@ -0,0 +1,15 @@
+-- The edit recipe of an image. Whenever the image is rendered it is rotated
+-- clockwise, then flipped, then cropped to the rectangle given in ten
+-- thousandths of its width and height. The uploaded file is never changed.
+ALTER TABLE images ADD COLUMN rotation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN flip_horizontal BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE images ADD COLUMN flip_vertical BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE images ADD COLUMN crop_left INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN crop_top INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN crop_right INTEGER NOT NULL DEFAULT 10000;
+ALTER TABLE images ADD COLUMN crop_bottom INTEGER NOT NULL DEFAULT 10000;
+
+ALTER TABLE images ADD CONSTRAINT images_rotation_ck CHECK (rotation IN (0, 90, 180, 270));
+ALTER TABLE images ADD CONSTRAINT images_crop_ck CHECK (
+  0 <= crop_left AND crop_left < crop_right AND crop_right <= 10000
+  AND 0 <= crop_top AND crop_top < crop_bottom AND crop_bottom <= 10000);
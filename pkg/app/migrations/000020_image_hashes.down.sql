@@ -0,0 +1,2 @@
+ALTER TABLE images DROP COLUMN dhash_failed;
+ALTER TABLE images DROP COLUMN dhash;
@@ -0,0 +1,5 @@
+-- The perceptual hash of the uploaded file of each image, used to find
+-- near-duplicates. It is NULL until it is computed, and dhash_failed is set
+-- when the file cannot be decoded, so that it is not tried again.
+ALTER TABLE images ADD COLUMN dhash BIGINT;
+ALTER TABLE images ADD COLUMN dhash_failed BOOL NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+DROP TABLE gallery_embed_views;
+DROP TABLE gallery_embed_origins;
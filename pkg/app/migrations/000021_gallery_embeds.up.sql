@@ -0,0 +1,20 @@
+-- Sites allowed to embed a public gallery in their pages, by origin, e.g.
+-- "https://www.example.com".
+CREATE TABLE gallery_embed_origins (
+  gallery_id UUID NOT NULL,
+  origin TEXT NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  CONSTRAINT gallery_embed_origins_pk PRIMARY KEY (gallery_id, origin),
+  CONSTRAINT rel_gallery_embed_origins_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
+
+-- Views of embedded galleries, counted per embedding origin and day. Days
+-- are stored as the unix time of their start, in UTC.
+CREATE TABLE gallery_embed_views (
+  gallery_id UUID NOT NULL,
+  origin TEXT NOT NULL,
+  day INTEGER NOT NULL,
+  views INTEGER NOT NULL DEFAULT 0,
+  CONSTRAINT gallery_embed_views_pk PRIMARY KEY (gallery_id, origin, day),
+  CONSTRAINT rel_gallery_embed_views_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
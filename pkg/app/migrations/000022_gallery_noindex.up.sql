@@ -0,0 +1,2 @@
+-- Public galleries left out of search engines by their owner.
+ALTER TABLE galleries ADD COLUMN noindex BOOL NOT NULL DEFAULT FALSE;
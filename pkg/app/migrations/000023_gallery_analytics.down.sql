@@ -0,0 +1,2 @@
+DROP TABLE gallery_view_stats;
+DROP TABLE gallery_view_events;
@@ -0,0 +1,29 @@
+-- Views of galleries by visitors, kept until they are added up into
+-- gallery_view_stats. Visitors are only known by a hash of their IP address
+-- that changes every day and for every gallery.
+CREATE TABLE gallery_view_events (
+  gallery_id UUID NOT NULL,
+  image_id UUID,
+  kind TEXT NOT NULL,
+  visitor TEXT NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::int,
+  CONSTRAINT gallery_view_events_kind_ck CHECK (kind IN ('gallery', 'image', 'download')),
+  CONSTRAINT rel_gallery_view_events_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE,
+  CONSTRAINT rel_gallery_view_events_images_id FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_gallery_view_events_gallery_id ON gallery_view_events (gallery_id);
+CREATE INDEX idx_gallery_view_events_created_at ON gallery_view_events (created_at);
+
+-- Views of galleries per day. Days are stored as the unix time of their
+-- start, in UTC.
+CREATE TABLE gallery_view_stats (
+  gallery_id UUID NOT NULL,
+  day INTEGER NOT NULL,
+  gallery_views INTEGER NOT NULL DEFAULT 0,
+  image_views INTEGER NOT NULL DEFAULT 0,
+  downloads INTEGER NOT NULL DEFAULT 0,
+  visitors INTEGER NOT NULL DEFAULT 0,
+  CONSTRAINT gallery_view_stats_pk PRIMARY KEY (gallery_id, day),
+  CONSTRAINT rel_gallery_view_stats_galleries_id FOREIGN KEY (gallery_id) REFERENCES galleries (id) ON DELETE CASCADE
+);
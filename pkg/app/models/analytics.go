@@ -0,0 +1,144 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ViewKind is what a visitor looked at.
+type ViewKind string
+
+const (
+	ViewGallery  ViewKind = "gallery"
+	ViewImage    ViewKind = "image"
+	ViewDownload ViewKind = "download"
+)
+
+// ViewStats counts the views of a gallery over a day.
+type ViewStats struct {
+	// Day is the unix time of the start of the day, in UTC.
+	Day          int64
+	GalleryViews int
+	ImageViews   int
+	Downloads    int
+	// Visitors is the number of different visitors in the day. Visitors
+	// coming back on another day are counted again.
+	Visitors int
+}
+
+// AnalyticsService records the views of galleries by their visitors and adds
+// them up per day. IP addresses are never stored: visitors are told apart by
+// a hash of their address, salted with Key, the gallery and the day, so they
+// cannot be followed across galleries or days. The hashes are deleted once
+// the day is over and added up.
+type AnalyticsService struct {
+	DB  *sql.DB
+	Key string
+}
+
+// unixDay returns the start of the day of t, in UTC, as stored in tables
+// counting things per day.
+func unixDay(t time.Time) int64 {
+	return t.UTC().Truncate(24 * time.Hour).Unix()
+}
+
+// visitor returns the hash standing for the visitor at ip in a gallery on
+// the given day.
+func (service *AnalyticsService) visitor(galleryID uuid.UUID, day int64, ip string) string {
+	sum := sha256.Sum256([]byte(service.Key + "\x00" + galleryID.String() + "\x00" + strconv.FormatInt(day, 10) + "\x00" + ip))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Record records a view of a gallery, or of one of its images, by the
+// visitor at ip.
+func (service *AnalyticsService) Record(galleryID uuid.UUID, imageID uuid.NullUUID, kind ViewKind, ip string) error {
+	now := time.Now()
+	_, err := service.DB.Exec(`
+		INSERT INTO gallery_view_events (gallery_id, image_id, kind, visitor, created_at)
+		VALUES ($1, $2, $3, $4, $5);`,
+		galleryID, imageID, kind, service.visitor(galleryID, unixDay(now), ip), now.Unix())
+	if err != nil {
+		return fmt.Errorf("record view: %w", err)
+	}
+	return nil
+}
+
+// Aggregate adds up the views recorded before today into the daily stats of
+// their galleries and deletes them. It returns the number of days of
+// galleries updated.
+func (service *AnalyticsService) Aggregate() (int, error) {
+	result, err := service.DB.Exec(`
+		WITH events AS (
+			DELETE FROM gallery_view_events
+			WHERE created_at < $1
+			RETURNING gallery_id, kind, visitor, created_at - created_at % 86400 AS day
+		)
+		INSERT INTO gallery_view_stats (gallery_id, day, gallery_views, image_views, downloads, visitors)
+		SELECT gallery_id, day,
+			COUNT(*) FILTER (WHERE kind = 'gallery'),
+			COUNT(*) FILTER (WHERE kind = 'image'),
+			COUNT(*) FILTER (WHERE kind = 'download'),
+			COUNT(DISTINCT visitor)
+		FROM events
+		GROUP BY gallery_id, day
+		ON CONFLICT (gallery_id, day) DO
+		UPDATE SET gallery_views = gallery_view_stats.gallery_views + EXCLUDED.gallery_views,
+			image_views = gallery_view_stats.image_views + EXCLUDED.image_views,
+			downloads = gallery_view_stats.downloads + EXCLUDED.downloads,
+			visitors = gallery_view_stats.visitors + EXCLUDED.visitors;`, unixDay(time.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("aggregate views: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("aggregate views: %w", err)
+	}
+	return int(n), nil
+}
+
+// Daily returns the views of a gallery on each day since since, oldest
+// first. Days without views are left out, and today is counted from the
+// views recorded so far.
+func (service *AnalyticsService) Daily(galleryID uuid.UUID, since time.Time) ([]ViewStats, error) {
+	rows, err := service.DB.Query(`
+		SELECT day, SUM(gallery_views), SUM(image_views), SUM(downloads), SUM(visitors)
+		FROM (
+			SELECT day, gallery_views, image_views, downloads, visitors
+			FROM gallery_view_stats
+			WHERE gallery_id = $1 AND day >= $2
+			UNION ALL
+			SELECT created_at - created_at % 86400,
+				COUNT(*) FILTER (WHERE kind = 'gallery'),
+				COUNT(*) FILTER (WHERE kind = 'image'),
+				COUNT(*) FILTER (WHERE kind = 'download'),
+				COUNT(DISTINCT visitor)
+			FROM gallery_view_events
+			WHERE gallery_id = $1 AND created_at >= $2
+			GROUP BY 1
+		) AS days
+		GROUP BY day
+		ORDER BY day;`, galleryID, unixDay(since))
+	if err != nil {
+		return nil, fmt.Errorf("daily views: %w", err)
+	}
+	defer rows.Close()
+	var stats []ViewStats
+	for rows.Next() {
+		var day ViewStats
+		err := rows.Scan(&day.Day, &day.GalleryViews, &day.ImageViews, &day.Downloads, &day.Visitors)
+		if err != nil {
+			return nil, fmt.Errorf("daily views: %w", err)
+		}
+		stats = append(stats, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("daily views: %w", err)
+	}
+	return stats, nil
+}
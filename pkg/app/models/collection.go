@@ -0,0 +1,303 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+)
+
+// Collection groups galleries, e.g. "Weddings 2026". Collections can be
+// nested inside other collections of the same user.
+type Collection struct {
+	ID       uuid.UUID     `json:"id"`
+	UserID   uuid.UUID     `json:"user_id"`
+	ParentID uuid.NullUUID `json:"parent_id"`
+	Title    string        `json:"title"`
+	// Galleries is the number of galleries directly in the collection. It is
+	// read-only.
+	Galleries int   `json:"galleries"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+type CollectionService struct {
+	DB *sql.DB
+}
+
+// Create adds a collection, at the top level or inside parentID.
+func (service *CollectionService) Create(userID uuid.UUID, parentID uuid.NullUUID, title string) (*Collection, error) {
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	collection := Collection{
+		ID:        ID,
+		UserID:    userID,
+		ParentID:  parentID,
+		Title:     strings.TrimSpace(title),
+		CreatedAt: time.Now().Unix(),
+	}
+	if collection.Title == "" {
+		return nil, fmt.Errorf("create collection: %w", ErrCollectionTitle)
+	}
+	// The parent, if any, must belong to the same user.
+	res, err := service.DB.Exec(`
+		INSERT INTO collections (id, user_id, parent_id, title, created_at)
+		SELECT $1, $2, $3, $4, $5
+		WHERE $3::uuid IS NULL OR EXISTS (SELECT 1 FROM collections WHERE id = $3 AND user_id = $2);`,
+		collection.ID, collection.UserID, collection.ParentID, collection.Title, collection.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("create collection: %w", collectionError(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("create collection: %w", err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("create collection: %w", ErrNotFound)
+	}
+	return &collection, nil
+}
+
+func collectionError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return ErrCollectionExists
+	}
+	return err
+}
+
+// ByUserID returns the collections of a user, by title. Use Tree to nest
+// them.
+func (service *CollectionService) ByUserID(userID uuid.UUID) ([]Collection, error) {
+	rows, err := service.DB.Query(`
+		SELECT collections.id, collections.parent_id, collections.title, collections.created_at,
+			(SELECT COUNT(*) FROM collection_galleries JOIN galleries ON galleries.id = collection_galleries.gallery_id
+				WHERE collection_galleries.collection_id = collections.id AND galleries.deleted_at IS NULL)
+		FROM collections
+		WHERE collections.user_id = $1
+		ORDER BY lower(collections.title), collections.created_at;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query collections: %w", err)
+	}
+	defer rows.Close()
+	var collections []Collection
+	for rows.Next() {
+		collection := Collection{
+			UserID: userID,
+		}
+		err := rows.Scan(&collection.ID, &collection.ParentID, &collection.Title, &collection.CreatedAt, &collection.Galleries)
+		if err != nil {
+			return nil, fmt.Errorf("query collections: %w", err)
+		}
+		collections = append(collections, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query collections: %w", err)
+	}
+	return collections, nil
+}
+
+// NestedCollection is a collection along with how deep it is nested.
+type NestedCollection struct {
+	Collection
+	Depth int
+}
+
+// Tree orders collections depth first, each one followed by its children,
+// keeping the order of collections among siblings.
+func Tree(collections []Collection) []NestedCollection {
+	children := map[uuid.UUID][]Collection{}
+	ids := map[uuid.UUID]bool{}
+	for _, collection := range collections {
+		ids[collection.ID] = true
+	}
+	var roots []Collection
+	for _, collection := range collections {
+		if collection.ParentID.Valid && ids[collection.ParentID.UUID] {
+			children[collection.ParentID.UUID] = append(children[collection.ParentID.UUID], collection)
+			continue
+		}
+		roots = append(roots, collection)
+	}
+	var tree []NestedCollection
+	var walk func(collections []Collection, depth int)
+	walk = func(collections []Collection, depth int) {
+		for _, collection := range collections {
+			tree = append(tree, NestedCollection{Collection: collection, Depth: depth})
+			walk(children[collection.ID], depth+1)
+		}
+	}
+	walk(roots, 0)
+	return tree
+}
+
+// Update renames a collection and moves it under collection.ParentID. A
+// collection cannot be moved inside itself or one of its descendants.
+func (service *CollectionService) Update(collection *Collection) error {
+	collection.Title = strings.TrimSpace(collection.Title)
+	if collection.Title == "" {
+		return fmt.Errorf("update collection: %w", ErrCollectionTitle)
+	}
+	if collection.ParentID.Valid {
+		var cycle bool
+		row := service.DB.QueryRow(`
+			WITH RECURSIVE descendants AS (
+				SELECT id FROM collections WHERE id = $1
+				UNION ALL
+				SELECT collections.id
+				FROM collections
+					JOIN descendants ON collections.parent_id = descendants.id
+			)
+			SELECT EXISTS (SELECT 1 FROM descendants WHERE id = $2);`, collection.ID, collection.ParentID.UUID)
+		err := row.Scan(&cycle)
+		if err != nil {
+			return fmt.Errorf("update collection: %w", err)
+		}
+		if cycle {
+			return fmt.Errorf("update collection: %w", ErrCollectionParent)
+		}
+	}
+	res, err := service.DB.Exec(`
+		UPDATE collections
+		SET title = $3, parent_id = $4, updated_at = $5
+		WHERE id = $1 AND user_id = $2
+			AND ($4::uuid IS NULL OR EXISTS (SELECT 1 FROM collections AS parent WHERE parent.id = $4 AND parent.user_id = $2));`,
+		collection.ID, collection.UserID, collection.Title, collection.ParentID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("update collection: %w", collectionError(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update collection: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("update collection: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// Delete removes a collection. Its galleries are kept and its
+// sub-collections move to the top level, renamed to "title (2)", "title
+// (3)"... when another top-level collection has their title.
+func (service *CollectionService) Delete(userID, id uuid.UUID) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`
+		SELECT id, title, parent_id = $1
+		FROM collections
+		WHERE user_id = $2 AND (parent_id IS NULL OR parent_id = $1) AND id <> $1;`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	taken := map[string]bool{}
+	var children []Collection
+	for rows.Next() {
+		var collection Collection
+		var child bool
+		err := rows.Scan(&collection.ID, &collection.Title, &child)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("delete collection: %w", err)
+		}
+		if child {
+			children = append(children, collection)
+		} else {
+			taken[collection.Title] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	for _, child := range children {
+		title := child.Title
+		for n := 2; taken[title]; n++ {
+			title = fmt.Sprintf("%s (%d)", child.Title, n)
+		}
+		taken[title] = true
+		_, err = tx.Exec(`
+			UPDATE collections
+			SET parent_id = NULL, title = $2, updated_at = $3
+			WHERE id = $1;`, child.ID, title, time.Now().Unix())
+		if err != nil {
+			return fmt.Errorf("delete collection: %w", collectionError(err))
+		}
+	}
+	_, err = tx.Exec(`
+		DELETE FROM collections
+		WHERE id = $1 AND user_id = $2;`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	return nil
+}
+
+// ByGalleryID returns the IDs of the collections the gallery is in.
+func (service *CollectionService) ByGalleryID(galleryID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := service.DB.Query(`
+		SELECT collection_id
+		FROM collection_galleries
+		WHERE gallery_id = $1;`, galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("query gallery collections: %w", err)
+	}
+	defer rows.Close()
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("query gallery collections: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query gallery collections: %w", err)
+	}
+	return ids, nil
+}
+
+// SetGalleryCollections replaces the collections a gallery is in. Only
+// collections of userID, the owner of the gallery, are used.
+func (service *CollectionService) SetGalleryCollections(userID, galleryID uuid.UUID, collectionIDs []uuid.UUID) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("set gallery collections: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		DELETE FROM collection_galleries
+		WHERE gallery_id = $1;`, galleryID)
+	if err != nil {
+		return fmt.Errorf("set gallery collections: %w", err)
+	}
+	for _, collectionID := range collectionIDs {
+		_, err = tx.Exec(`
+			INSERT INTO collection_galleries (collection_id, gallery_id)
+			SELECT id, $2
+			FROM collections
+			WHERE id = $1 AND user_id = $3
+			ON CONFLICT DO NOTHING;`, collectionID, galleryID, userID)
+		if err != nil {
+			return fmt.Errorf("set gallery collections: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("set gallery collections: %w", err)
+	}
+	return nil
+}
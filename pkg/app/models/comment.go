@@ -0,0 +1,274 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxCommentLength is the maximum number of characters in a comment.
+	MaxCommentLength = 2000
+	// DefaultCommentMaxLinks is the number of links a comment can contain
+	// when CommentService.MaxLinks is not set.
+	DefaultCommentMaxLinks = 2
+	// DefaultCommentRateLimit is the number of comments an author can post
+	// per DefaultCommentRateWindow when CommentService.RateLimit is not set.
+	DefaultCommentRateLimit  = 5
+	DefaultCommentRateWindow = 10 * time.Minute
+)
+
+type CommentStatus string
+
+const (
+	// CommentPending comments wait for the owner to approve them.
+	CommentPending  CommentStatus = "pending"
+	CommentApproved CommentStatus = "approved"
+	CommentHidden   CommentStatus = "hidden"
+)
+
+// ParseCommentStatus returns the status named s, or ErrInvalidCommentStatus.
+func ParseCommentStatus(s string) (CommentStatus, error) {
+	switch status := CommentStatus(s); status {
+	case CommentPending, CommentApproved, CommentHidden:
+		return status, nil
+	}
+	return "", ErrInvalidCommentStatus
+}
+
+// Comment is left on a gallery or, when ImageID is set, on one of its
+// images. Replies point to the comment they answer through ParentID.
+type Comment struct {
+	ID        uuid.UUID     `json:"id"`
+	GalleryID uuid.UUID     `json:"gallery_id"`
+	ImageID   uuid.NullUUID `json:"image_id"`
+	ParentID  uuid.NullUUID `json:"parent_id"`
+	// UserID is set when the author was signed in, guests only leave a name.
+	UserID      uuid.NullUUID `json:"user_id"`
+	AuthorName  string        `json:"author_name"`
+	AuthorEmail string        `json:"author_email"`
+	Body        string        `json:"body"`
+	Status      CommentStatus `json:"status"`
+	CreatedAt   int64         `json:"created_at"`
+	// ImageFilename is the name of the image the comment is about. It is
+	// read-only.
+	ImageFilename string `json:"image_filename"`
+	// IP is the address the comment was posted from. Only its hash is
+	// stored, to rate limit guests.
+	IP string `json:"-"`
+}
+
+type CommentService struct {
+	DB *sql.DB
+	// Key salts the hashes of the IP addresses comments are posted from, so
+	// that the addresses cannot be guessed back from the hashes.
+	Key string
+	// MaxLinks is the number of links a comment can contain. If this value is
+	// not set DefaultCommentMaxLinks will be used.
+	MaxLinks int
+	// RateLimit is the number of comments an author, or an IP address, can
+	// post per RateWindow. If these values are not set DefaultCommentRateLimit
+	// and DefaultCommentRateWindow will be used.
+	RateLimit  int
+	RateWindow time.Duration
+}
+
+var linkRegexp = regexp.MustCompile(`(?i)\b(https?://|www\.)`)
+
+// Create validates and saves a new comment by an author with the given role
+// in the gallery, or none for visitors. Comments by the people moderating the
+// gallery are approved right away, as are comments without links by the
+// other members. Everything else waits for moderation.
+func (service *CommentService) Create(comment *Comment, role GalleryRole) error {
+	trusted := role.Can(RoleCoOwner)
+	comment.Body = strings.TrimSpace(comment.Body)
+	comment.AuthorName = strings.TrimSpace(comment.AuthorName)
+	comment.AuthorEmail = strings.TrimSpace(comment.AuthorEmail)
+	if comment.Body == "" {
+		return fmt.Errorf("create comment: %w", ErrCommentEmpty)
+	}
+	if utf8.RuneCountInString(comment.Body) > MaxCommentLength {
+		return fmt.Errorf("create comment: %w", ErrCommentTooLong)
+	}
+	if comment.AuthorName == "" {
+		return fmt.Errorf("create comment: %w", ErrCommentAuthor)
+	}
+	links := len(linkRegexp.FindAllStringIndex(comment.Body, -1))
+	if !trusted && links > service.maxLinks() {
+		return fmt.Errorf("create comment: %w", ErrCommentLinks)
+	}
+	ipHash := service.hashIP(comment.IP)
+	if !trusted {
+		err := service.checkRate(comment.UserID, ipHash)
+		if err != nil {
+			return fmt.Errorf("create comment: %w", err)
+		}
+	}
+	if comment.ParentID.Valid {
+		// Replies belong to the same gallery and image as their parent.
+		var imageID uuid.NullUUID
+		row := service.DB.QueryRow(`
+			SELECT image_id
+			FROM comments
+			WHERE id = $1 AND gallery_id = $2;`, comment.ParentID.UUID, comment.GalleryID)
+		err := row.Scan(&imageID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("create comment: %w", ErrNotFound)
+			}
+			return fmt.Errorf("create comment: %w", err)
+		}
+		comment.ImageID = imageID
+	}
+
+	comment.Status = CommentPending
+	if trusted || (role.Can(RoleViewer) && links == 0) {
+		comment.Status = CommentApproved
+	}
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	comment.ID = ID
+	comment.CreatedAt = time.Now().Unix()
+	// Only images of the gallery, out of the trash, can be commented on.
+	res, err := service.DB.Exec(`
+		INSERT INTO comments (id, gallery_id, image_id, parent_id, user_id, author_name, author_email, body, status, ip_hash, created_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+		WHERE $3::uuid IS NULL OR EXISTS (
+			SELECT 1 FROM images WHERE images.id = $3 AND images.gallery_id = $2 AND images.deleted_at IS NULL);`,
+		comment.ID, comment.GalleryID, comment.ImageID, comment.ParentID, comment.UserID, comment.AuthorName,
+		comment.AuthorEmail, comment.Body, comment.Status, ipHash, comment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create comment: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("create comment: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("create comment: %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (service *CommentService) maxLinks() int {
+	if service.MaxLinks > 0 {
+		return service.MaxLinks
+	}
+	return DefaultCommentMaxLinks
+}
+
+// checkRate returns ErrCommentRateLimit when the author, or anyone from the
+// same IP address, posted too many comments recently.
+func (service *CommentService) checkRate(userID uuid.NullUUID, ipHash string) error {
+	limit := service.RateLimit
+	if limit <= 0 {
+		limit = DefaultCommentRateLimit
+	}
+	window := service.RateWindow
+	if window <= 0 {
+		window = DefaultCommentRateWindow
+	}
+	var count int
+	row := service.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM comments
+		WHERE created_at > $3
+			AND (($1::uuid IS NOT NULL AND user_id = $1) OR ($2 <> '' AND ip_hash = $2));`,
+		userID, ipHash, time.Now().Add(-window).Unix())
+	err := row.Scan(&count)
+	if err != nil {
+		return fmt.Errorf("check comment rate: %w", err)
+	}
+	if count >= limit {
+		return ErrCommentRateLimit
+	}
+	return nil
+}
+
+func (service *CommentService) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(service.Key + "\x00" + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+// ByGalleryID returns the comments of the gallery and its images, oldest
+// first. Only approved comments are returned unless all is set.
+func (service *CommentService) ByGalleryID(galleryID uuid.UUID, all bool) ([]Comment, error) {
+	rows, err := service.DB.Query(`
+		SELECT comments.id, comments.image_id, comments.parent_id, comments.user_id, comments.author_name,
+			comments.author_email, comments.body, comments.status, comments.created_at, COALESCE(images.filename, '')
+		FROM comments
+			LEFT JOIN images ON images.id = comments.image_id
+		WHERE comments.gallery_id = $1 AND ($2 OR comments.status = 'approved')
+		ORDER BY comments.created_at;`, galleryID, all)
+	if err != nil {
+		return nil, fmt.Errorf("query comments: %w", err)
+	}
+	defer rows.Close()
+	var comments []Comment
+	for rows.Next() {
+		comment := Comment{
+			GalleryID: galleryID,
+		}
+		err := rows.Scan(&comment.ID, &comment.ImageID, &comment.ParentID, &comment.UserID, &comment.AuthorName,
+			&comment.AuthorEmail, &comment.Body, &comment.Status, &comment.CreatedAt, &comment.ImageFilename)
+		if err != nil {
+			return nil, fmt.Errorf("query comments: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query comments: %w", err)
+	}
+	return comments, nil
+}
+
+// Pending returns the number of comments of the gallery waiting for
+// moderation.
+func (service *CommentService) Pending(galleryID uuid.UUID) (int, error) {
+	var count int
+	row := service.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM comments
+		WHERE gallery_id = $1 AND status = 'pending';`, galleryID)
+	err := row.Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count pending comments: %w", err)
+	}
+	return count, nil
+}
+
+// SetStatus approves or hides a comment.
+func (service *CommentService) SetStatus(galleryID, id uuid.UUID, status CommentStatus) error {
+	_, err := service.DB.Exec(`
+		UPDATE comments
+		SET status = $3, updated_at = $4
+		WHERE id = $1 AND gallery_id = $2;`, id, galleryID, status, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("set comment status: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a comment and its replies.
+func (service *CommentService) Delete(galleryID, id uuid.UUID) error {
+	_, err := service.DB.Exec(`
+		DELETE FROM comments
+		WHERE id = $1 AND gallery_id = $2;`, id, galleryID)
+	if err != nil {
+		return fmt.Errorf("delete comment: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/AguilaMike/lenslocked/pkg/internal/imaging"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultDuplicateDistance is the default number of bits, out of 64, by
+	// which the perceptual hashes of near-duplicates may differ.
+	DefaultDuplicateDistance = 10
+	// MaxDuplicateDistance is the largest distance users can pick. Beyond it
+	// unrelated photos start to be grouped together.
+	MaxDuplicateDistance = 24
+)
+
+// readDHash returns the perceptual hash of the image in r, or NULL when it
+// cannot be decoded.
+func readDHash(r io.Reader) sql.NullInt64 {
+	img, _, err := imaging.Decode(r)
+	if err != nil {
+		return sql.NullInt64{}
+	}
+	// Stored as a signed BIGINT, bits unchanged.
+	return sql.NullInt64{Int64: int64(imaging.DHash(img)), Valid: true}
+}
+
+// NearDuplicates groups the images of a gallery whose perceptual hashes
+// differ by at most maxDistance bits, such as the frames of a burst. Images
+// without near-duplicates are left out. Groups and the images within them
+// are in gallery order.
+//
+// Hashes are computed at upload time. Images uploaded before that are left
+// out until HashImages gets to them.
+func (service *GalleryService) NearDuplicates(galleryID uuid.UUID, maxDistance int) ([][]Image, error) {
+	images, err := service.Images(galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("near duplicates: %w", err)
+	}
+	hashes, err := service.dhashes(galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("near duplicates: %w", err)
+	}
+
+	// Union-find over every pair of close images, so that a burst drifting
+	// slowly from frame to frame still ends up in a single group.
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range images {
+		a, ok := hashes[images[i].ID]
+		if !ok {
+			continue
+		}
+		for j := i + 1; j < len(images); j++ {
+			b, ok := hashes[images[j].ID]
+			if ok && imaging.Distance(a, b) <= maxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	groups := map[int][]Image{}
+	var roots []int
+	for i, image := range images {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], image)
+	}
+	var result [][]Image
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			result = append(result, groups[root])
+		}
+	}
+	return result, nil
+}
+
+// dhashes returns the perceptual hashes of the images of a gallery that have
+// one.
+func (service *GalleryService) dhashes(galleryID uuid.UUID) (map[uuid.UUID]uint64, error) {
+	rows, err := service.DB.Query(`
+		SELECT id, dhash
+		FROM images
+		WHERE gallery_id = $1 AND deleted_at IS NULL AND dhash IS NOT NULL;`, galleryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hashes := map[uuid.UUID]uint64{}
+	for rows.Next() {
+		var id uuid.UUID
+		var hash int64
+		err := rows.Scan(&id, &hash)
+		if err != nil {
+			return nil, err
+		}
+		hashes[id] = uint64(hash)
+	}
+	return hashes, rows.Err()
+}
+
+// hashImagesBatch is the number of images HashImages reads at once.
+const hashImagesBatch = 100
+
+// HashImages computes and stores the perceptual hashes of the images that
+// have none yet, e.g. those uploaded before hashes were computed at upload
+// time. Images whose file cannot be read or decoded are marked so that they
+// are not tried again. It returns the number of images hashed.
+func (service *GalleryService) HashImages() (int, error) {
+	hashed := 0
+	for {
+		images, err := service.unhashedImages(hashImagesBatch)
+		if err != nil {
+			return hashed, fmt.Errorf("hash images: %w", err)
+		}
+		for _, image := range images {
+			ok, err := service.storeDHash(image)
+			if err != nil {
+				return hashed, fmt.Errorf("hash images: %w", err)
+			}
+			if ok {
+				hashed++
+			}
+		}
+		if len(images) < hashImagesBatch {
+			return hashed, nil
+		}
+	}
+}
+
+// unhashedImages returns up to limit images, trashed ones included, that
+// were never hashed.
+func (service *GalleryService) unhashedImages(limit int) ([]Image, error) {
+	rows, err := service.DB.Query(`
+		SELECT id, gallery_id, checksum, extension
+		FROM images
+		WHERE dhash IS NULL AND NOT dhash_failed
+		LIMIT $1;`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var images []Image
+	for rows.Next() {
+		var image Image
+		var galleryID uuid.UUID
+		err := rows.Scan(&image.ID, &galleryID, &image.Checksum, &image.Extension)
+		if err != nil {
+			return nil, err
+		}
+		image.GalleryID = galleryID.String()
+		image.Path = service.imagePath(galleryID, image.Checksum, image.Extension)
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// storeDHash computes and stores the perceptual hash of image, and reports
+// whether it has one. Images that cannot be read or decoded are marked
+// instead.
+func (service *GalleryService) storeDHash(image Image) (bool, error) {
+	hash := sql.NullInt64{}
+	file, err := os.Open(image.Path)
+	if err == nil {
+		hash = readDHash(file)
+		file.Close()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	_, err = service.DB.Exec(`
+		UPDATE images
+		SET dhash = $2, dhash_failed = $3
+		WHERE id = $1;`, image.ID, hash, !hash.Valid)
+	if err != nil {
+		return false, err
+	}
+	return hash.Valid, nil
+}
+
+// DeleteImages moves the images of the gallery in imageIDs to the trash.
+// IDs that do not belong to the gallery are ignored. It returns how many
+// images were deleted.
+func (service *GalleryService) DeleteImages(galleryID uuid.UUID, imageIDs []uuid.UUID) (int, error) {
+	if len(imageIDs) == 0 {
+		return 0, fmt.Errorf("delete images: %w", ErrNoImagesSelected)
+	}
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("delete images: %w", err)
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	var deleted int64
+	for _, id := range imageIDs {
+		res, err := tx.Exec(`
+			UPDATE images
+			SET deleted_at = $3
+			WHERE id = $1 AND gallery_id = $2 AND deleted_at IS NULL;`, id, galleryID, now)
+		if err != nil {
+			return 0, fmt.Errorf("delete images: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("delete images: %w", err)
+		}
+		deleted += n
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("delete images: %w", err)
+	}
+	return int(deleted), nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"html"
 	"log"
 
 	"github.com/go-mail/mail/v2"
@@ -89,13 +90,87 @@ func (es *EmailService) ForgotPassword(to, resetURL string) error {
 		Plaintext: "To reset your password, please visit the following link: " + resetURL,
 		HTML:      `<p>To reset your password, please visit the following link: <a href="` + resetURL + `">` + resetURL + `</a></p>`,
 	}
-	if es.DefaultSender == to {
+	return es.deliver(email, "forgot password email")
+}
+
+func (es *EmailService) GalleryInvitation(to, galleryTitle string, role GalleryRole, acceptURL string) error {
+	email := Email{
+		Subject:   "You have been invited to " + galleryTitle,
+		To:        to,
+		Plaintext: "You have been invited to join the gallery \"" + galleryTitle + "\" as " + string(role) + ". To accept, please visit the following link: " + acceptURL,
+		HTML:      `<p>You have been invited to join the gallery "` + html.EscapeString(galleryTitle) + `" as ` + string(role) + `.</p><p>To accept, please visit the following link: <a href="` + acceptURL + `">` + acceptURL + `</a></p>`,
+	}
+	return es.deliver(email, "gallery invitation email")
+}
+
+func (es *EmailService) OwnershipTransferRequest(to, galleryTitle, fromEmail, acceptURL string) error {
+	email := Email{
+		Subject:   fromEmail + " wants to give you " + galleryTitle,
+		To:        to,
+		Plaintext: fmt.Sprintf("%s wants to make you the owner of the gallery \"%s\". To accept, please visit the following link: %s", fromEmail, galleryTitle, acceptURL),
+		HTML:      fmt.Sprintf(`<p>%s wants to make you the owner of the gallery "%s".</p><p>To accept, please visit the following link: <a href="%s">%s</a></p>`, html.EscapeString(fromEmail), html.EscapeString(galleryTitle), acceptURL, acceptURL),
+	}
+	return es.deliver(email, "ownership transfer request email")
+}
+
+func (es *EmailService) OwnershipTransferred(to, galleryTitle, newOwnerEmail string) error {
+	email := Email{
+		Subject:   galleryTitle + " now belongs to " + newOwnerEmail,
+		To:        to,
+		Plaintext: fmt.Sprintf("%s accepted the gallery \"%s\" and is now its owner. You no longer have access to it.", newOwnerEmail, galleryTitle),
+		HTML:      fmt.Sprintf(`<p>%s accepted the gallery "%s" and is now its owner. You no longer have access to it.</p>`, html.EscapeString(newOwnerEmail), html.EscapeString(galleryTitle)),
+	}
+	return es.deliver(email, "ownership transferred email")
+}
+
+func (es *EmailService) OwnershipReceived(to, galleryTitle, galleryURL string) error {
+	email := Email{
+		Subject:   "You are now the owner of " + galleryTitle,
+		To:        to,
+		Plaintext: fmt.Sprintf("You are now the owner of the gallery \"%s\". You can manage it here: %s", galleryTitle, galleryURL),
+		HTML:      fmt.Sprintf(`<p>You are now the owner of the gallery "%s".</p><p>You can manage it here: <a href="%s">%s</a></p>`, html.EscapeString(galleryTitle), galleryURL, galleryURL),
+	}
+	return es.deliver(email, "ownership received email")
+}
+
+func (es *EmailService) SelectionSubmitted(to, galleryTitle, clientName string, picks int, selectionURL string) error {
+	if clientName == "" {
+		clientName = "A client"
+	}
+	email := Email{
+		Subject:   clientName + " submitted a selection for " + galleryTitle,
+		To:        to,
+		Plaintext: fmt.Sprintf("%s picked %d images from \"%s\". You can review the selection here: %s", clientName, picks, galleryTitle, selectionURL),
+		HTML:      fmt.Sprintf(`<p>%s picked %d images from "%s".</p><p>You can review the selection here: <a href="%s">%s</a></p>`, html.EscapeString(clientName), picks, html.EscapeString(galleryTitle), selectionURL, selectionURL),
+	}
+	return es.deliver(email, "selection submitted email")
+}
+
+func (es *EmailService) NewComment(to, galleryTitle string, comment Comment, moderateURL string) error {
+	subject := comment.AuthorName + " commented on " + galleryTitle
+	status := "It is visible to visitors of the gallery."
+	if comment.Status == CommentPending {
+		status = "It is waiting for your approval."
+	}
+	email := Email{
+		Subject:   subject,
+		To:        to,
+		Plaintext: fmt.Sprintf("%s wrote:\n\n%s\n\n%s You can moderate the comments of \"%s\" here: %s", comment.AuthorName, comment.Body, status, galleryTitle, moderateURL),
+		HTML:      fmt.Sprintf(`<p>%s wrote:</p><blockquote>%s</blockquote><p>%s You can moderate the comments of "%s" here: <a href="%s">%s</a></p>`, html.EscapeString(comment.AuthorName), html.EscapeString(comment.Body), status, html.EscapeString(galleryTitle), moderateURL, moderateURL),
+	}
+	return es.deliver(email, "new comment email")
+}
+
+// deliver sends email, or only logs it when it is addressed to the default
+// sender, which is how emails are inspected during development.
+func (es *EmailService) deliver(email Email, kind string) error {
+	if es.DefaultSender == email.To {
 		log.Printf("Subject: [%s]\nTo: [%s]\n PlainText: [%s]\nHTML: [%s]", email.Subject, email.To, email.Plaintext, email.HTML)
-	} else {
-		err := es.Send(email)
-		if err != nil {
-			return fmt.Errorf("forgot password email: %w", err)
-		}
+		return nil
+	}
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", kind, err)
 	}
 	return nil
 }
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxEmbedOrigins is the number of sites a gallery can be embedded in.
+const MaxEmbedOrigins = 20
+
+// EmbedViews counts the views of an embedded gallery on one site.
+type EmbedViews struct {
+	Origin string `json:"origin"`
+	Views  int    `json:"views"`
+}
+
+// EmbedService keeps the sites each public gallery may be embedded in, and
+// counts the views of the embedded galleries.
+type EmbedService struct {
+	DB *sql.DB
+}
+
+// ParseOrigin returns the origin of a site typed by a user, e.g.
+// "https://www.example.com" for "https://WWW.example.com/blog/" or for
+// "www.example.com".
+func ParseOrigin(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "", ErrInvalidEmbedOrigin
+	}
+	host := strings.ToLower(u.Host)
+	// Origins end up in Content-Security-Policy headers, where anything but
+	// a plain host would change the policy.
+	for _, c := range host {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune(".-:[]", c)) {
+			return "", ErrInvalidEmbedOrigin
+		}
+	}
+	return u.Scheme + "://" + host, nil
+}
+
+// Origins returns the origins allowed to embed a gallery.
+func (service *EmbedService) Origins(galleryID uuid.UUID) ([]string, error) {
+	rows, err := service.DB.Query(`
+		SELECT origin
+		FROM gallery_embed_origins
+		WHERE gallery_id = $1
+		ORDER BY origin;`, galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("embed origins: %w", err)
+	}
+	defer rows.Close()
+	var origins []string
+	for rows.Next() {
+		var origin string
+		err := rows.Scan(&origin)
+		if err != nil {
+			return nil, fmt.Errorf("embed origins: %w", err)
+		}
+		origins = append(origins, origin)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("embed origins: %w", err)
+	}
+	return origins, nil
+}
+
+// SetOrigins replaces the origins allowed to embed a gallery with the sites
+// in values.
+func (service *EmbedService) SetOrigins(galleryID uuid.UUID, values []string) error {
+	var origins []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		origin, err := ParseOrigin(value)
+		if err != nil {
+			return fmt.Errorf("set embed origins: %w", err)
+		}
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) > MaxEmbedOrigins {
+		return fmt.Errorf("set embed origins: %w", ErrInvalidEmbedOrigin)
+	}
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("set embed origins: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		DELETE FROM gallery_embed_origins
+		WHERE gallery_id = $1;`, galleryID)
+	if err != nil {
+		return fmt.Errorf("set embed origins: %w", err)
+	}
+	now := time.Now().Unix()
+	for _, origin := range origins {
+		_, err = tx.Exec(`
+			INSERT INTO gallery_embed_origins (gallery_id, origin, created_at)
+			VALUES ($1, $2, $3);`, galleryID, origin, now)
+		if err != nil {
+			return fmt.Errorf("set embed origins: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("set embed origins: %w", err)
+	}
+	return nil
+}
+
+// CountView counts a view of a gallery embedded in the site at origin.
+func (service *EmbedService) CountView(galleryID uuid.UUID, origin string) error {
+	_, err := service.DB.Exec(`
+		INSERT INTO gallery_embed_views (gallery_id, origin, day, views)
+		VALUES ($1, $2, $3, 1) ON CONFLICT (gallery_id, origin, day) DO
+		UPDATE SET views = gallery_embed_views.views + 1;`, galleryID, origin, unixDay(time.Now()))
+	if err != nil {
+		return fmt.Errorf("count embed view: %w", err)
+	}
+	return nil
+}
+
+// Views returns the views of a gallery on each site it is embedded in, over
+// the days since since, most viewed first.
+func (service *EmbedService) Views(galleryID uuid.UUID, since time.Time) ([]EmbedViews, error) {
+	rows, err := service.DB.Query(`
+		SELECT origin, SUM(views)
+		FROM gallery_embed_views
+		WHERE gallery_id = $1 AND day >= $2
+		GROUP BY origin
+		ORDER BY 2 DESC, origin;`, galleryID, unixDay(since))
+	if err != nil {
+		return nil, fmt.Errorf("embed views: %w", err)
+	}
+	defer rows.Close()
+	var views []EmbedViews
+	for rows.Next() {
+		var v EmbedViews
+		err := rows.Scan(&v.Origin, &v.Views)
+		if err != nil {
+			return nil, fmt.Errorf("embed views: %w", err)
+		}
+		views = append(views, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("embed views: %w", err)
+	}
+	return views, nil
+}
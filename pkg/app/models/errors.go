@@ -10,11 +10,35 @@ import (
 )
 
 var (
-	ErrNotFound      = errors.New("models: resource could not be found")
-	ErrEmailTaken    = errors.Public(errors.New("models: email address is already in use"), "That email address is already associated with an account.")
-	ErrUserNotFound  = errors.Public(errors.New("models: we were unable to find a user"), "We were unable to find a user with that email address.")
-	ErrPasswordError = errors.Public(errors.New("models: that password is incorrect"), "That password is incorrect.")
-	ErrInvalidID     = errors.Public(errors.New("models: ID provided was invalid"), "Invalid ID provided.")
+	ErrNotFound             = errors.New("models: resource could not be found")
+	ErrEmailTaken           = errors.Public(errors.New("models: email address is already in use"), "That email address is already associated with an account.")
+	ErrUserNotFound         = errors.Public(errors.New("models: we were unable to find a user"), "We were unable to find a user with that email address.")
+	ErrPasswordError        = errors.Public(errors.New("models: that password is incorrect"), "That password is incorrect.")
+	ErrInvalidID            = errors.Public(errors.New("models: ID provided was invalid"), "Invalid ID provided.")
+	ErrDuplicateImage       = errors.Public(errors.New("models: image already exists in gallery"), "That image has already been uploaded to this gallery.")
+	ErrInvalidRole          = errors.Public(errors.New("models: invalid gallery role"), "Please pick a valid role.")
+	ErrInvitationEmail      = errors.Public(errors.New("models: invitation was sent to another email"), "This invitation was sent to a different email address.")
+	ErrSelectionLimit       = errors.Public(errors.New("models: selection limit reached"), "You have already picked the maximum number of images.")
+	ErrSelectionSubmitted   = errors.Public(errors.New("models: selection already submitted"), "Your selection has already been submitted.")
+	ErrSelectionEmpty       = errors.Public(errors.New("models: selection is empty"), "Please pick at least one image before submitting.")
+	ErrCommentEmpty         = errors.Public(errors.New("models: comment is empty"), "Please write a comment.")
+	ErrCommentTooLong       = errors.Public(errors.New("models: comment is too long"), "Your comment is too long.")
+	ErrCommentAuthor        = errors.Public(errors.New("models: comment has no author"), "Please tell us your name.")
+	ErrCommentLinks         = errors.Public(errors.New("models: comment has too many links"), "Your comment contains too many links.")
+	ErrCommentRateLimit     = errors.Public(errors.New("models: too many comments"), "You are commenting too fast, please try again in a few minutes.")
+	ErrInvalidCommentStatus = errors.New("models: invalid comment status")
+	ErrCollectionTitle      = errors.Public(errors.New("models: collection title is empty"), "Please give the collection a title.")
+	ErrCollectionExists     = errors.Public(errors.New("models: collection already exists"), "There is already a collection with that title here.")
+	ErrCollectionParent     = errors.Public(errors.New("models: collection cannot be moved inside itself"), "A collection cannot be moved inside itself.")
+	ErrInvalidCursor        = errors.New("models: invalid page cursor")
+	ErrSameGallery          = errors.Public(errors.New("models: source and destination galleries are the same"), "Please pick another gallery.")
+	ErrNoImagesSelected     = errors.Public(errors.New("models: no images selected"), "Please select at least one image.")
+	ErrTransferToSelf       = errors.Public(errors.New("models: gallery transferred to its owner"), "You already own this gallery.")
+	ErrTransferEmail        = errors.Public(errors.New("models: ownership transfer was sent to another email"), "This gallery was offered to a different email address.")
+	ErrGalleryTitleTaken    = errors.Public(errors.New("models: gallery title already in use"), "You already have a gallery with that title, please pick another one.")
+	ErrInvalidWatermark     = errors.Public(errors.New("models: invalid watermark settings"), "Please pick a valid position, an opacity between 0 and 100 and a scale between 1 and 100.")
+	ErrInvalidImageEdit     = errors.Public(errors.New("models: invalid image edit"), "Please pick a crop within the image.")
+	ErrInvalidEmbedOrigin   = errors.Public(errors.New("models: invalid embed origin"), "Please enter up to 20 sites, one per line, such as https://www.example.com.")
 )
 
 type FileError struct {
@@ -1,10 +1,11 @@
 package models
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,15 +13,69 @@ import (
 
 	"github.com/AguilaMike/lenslocked/pkg/app/errors"
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 )
 
 type Gallery struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Title     string    `json:"title"`
-	CreatedAt int64     `json:"created_at"`
-	UpdatedAt *int64    `json:"updated_at"`
-	Public    bool      `json:"published"`
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Title  string    `json:"title"`
+	// Slug identifies the gallery in URLs. It follows the title.
+	Slug      string `json:"slug"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt *int64 `json:"updated_at"`
+	Public    bool   `json:"published"`
+	// AllowDownload lets visitors download the gallery as a ZIP archive.
+	AllowDownload bool `json:"allow_download"`
+	// CoverImageID is the image picked by the owner to represent the gallery.
+	CoverImageID uuid.NullUUID `json:"cover_image_id"`
+	// ThumbnailID is the cover image or, when none was picked, the first
+	// image of the gallery. It is read-only and not set on new galleries.
+	ThumbnailID uuid.NullUUID `json:"thumbnail_id"`
+	// thumbnailKey is the versionKey of the thumbnail.
+	thumbnailKey sql.NullString
+	// ProofingEnabled lets visitors pick their favourite images and submit
+	// them to the owner.
+	ProofingEnabled bool `json:"proofing_enabled"`
+	// SelectionLimit is the maximum number of images a visitor can pick.
+	// Zero means there is no limit.
+	SelectionLimit int `json:"selection_limit"`
+	// CommentsEnabled lets visitors comment on the gallery and its images.
+	CommentsEnabled bool `json:"comments_enabled"`
+	// NoIndex asks search engines not to list a public gallery.
+	NoIndex bool `json:"noindex"`
+}
+
+// galleryColumns lists the columns read by scanGallery, in order.
+const galleryColumns = `
+	galleries.id, galleries.user_id, galleries.title, galleries.slug, galleries.created_at, galleries.updated_at,
+	galleries.published, galleries.allow_download, galleries.cover_image_id,
+	galleries.proofing_enabled, galleries.selection_limit, galleries.comments_enabled, galleries.noindex,
+	(SELECT images.id ` + thumbnailQuery + `),
+	(SELECT ` + imageVersionKey + ` ` + thumbnailQuery + `)`
+
+// thumbnailQuery finds the thumbnail of a gallery: its cover image or, when
+// none was picked, its first image.
+const thumbnailQuery = `
+	FROM images
+	WHERE images.gallery_id = galleries.id AND images.deleted_at IS NULL
+	ORDER BY (images.id = galleries.cover_image_id) IS TRUE DESC, images.position, images.created_at
+	LIMIT 1`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanGallery(row scanner) (*Gallery, error) {
+	var gallery Gallery
+	err := row.Scan(&gallery.ID, &gallery.UserID, &gallery.Title, &gallery.Slug, &gallery.CreatedAt, &gallery.UpdatedAt,
+		&gallery.Public, &gallery.AllowDownload, &gallery.CoverImageID,
+		&gallery.ProofingEnabled, &gallery.SelectionLimit, &gallery.CommentsEnabled, &gallery.NoIndex, &gallery.ThumbnailID, &gallery.thumbnailKey)
+	if err != nil {
+		return nil, err
+	}
+	return &gallery, nil
 }
 
 type GalleryService struct {
@@ -29,23 +84,36 @@ type GalleryService struct {
 	// ImagesDir is used to tell the GalleryService where to store and locate images.
 	// If not set, the GalleryService will default to using the "images" directory.
 	ImagesDir string
+
+	// TrashRetention is how long deleted galleries and images can be restored
+	// before PurgeExpired deletes them for good. If not set,
+	// DefaultTrashRetention is used.
+	TrashRetention time.Duration
 }
 
-func (service *GalleryService) Create(title string, userID uuid.UUID, public bool) (*Gallery, error) {
+func (service *GalleryService) Create(title string, userID uuid.UUID, public, allowDownload bool) (*Gallery, error) {
 	ID, err := uuid.NewUUID()
 	if err != nil {
 		return nil, fmt.Errorf("%s %w", "error creating uuid", err)
 	}
 	gallery := Gallery{
-		ID:        ID,
-		Title:     title,
-		UserID:    userID,
-		CreatedAt: time.Now().Unix(),
-		Public:    public,
+		ID:            ID,
+		Title:         title,
+		UserID:        userID,
+		CreatedAt:     time.Now().Unix(),
+		Public:        public,
+		AllowDownload: allowDownload,
+		// Matches the column default.
+		CommentsEnabled: true,
+	}
+	gallery.Slug, err = service.availableSlug(userID, Slugify(title), gallery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("create gallery: %w", err)
 	}
 	row := service.DB.QueryRow(`
-		INSERT INTO galleries (id, title, user_id, created_at, published)
-		VALUES ($1, $2, $3, $4, $5) RETURNING id;`, gallery.ID, gallery.Title, gallery.UserID, gallery.CreatedAt, gallery.Public)
+		INSERT INTO galleries (id, title, slug, user_id, created_at, published, allow_download)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;`,
+		gallery.ID, gallery.Title, gallery.Slug, gallery.UserID, gallery.CreatedAt, gallery.Public, gallery.AllowDownload)
 	err = row.Scan(&gallery.ID)
 	if err != nil {
 		return nil, fmt.Errorf("create gallery: %w", err)
@@ -54,14 +122,11 @@ func (service *GalleryService) Create(title string, userID uuid.UUID, public boo
 }
 
 func (service *GalleryService) ByID(id uuid.UUID) (*Gallery, error) {
-	gallery := Gallery{
-		ID: id,
-	}
 	row := service.DB.QueryRow(`
-		SELECT title, user_id, created_at, updated_at, published
+		SELECT `+galleryColumns+`
 		FROM galleries
-		WHERE id = $1;`, gallery.ID)
-	err := row.Scan(&gallery.Title, &gallery.UserID, &gallery.CreatedAt, &gallery.UpdatedAt, &gallery.Public)
+		WHERE id = $1 AND deleted_at IS NULL;`, id)
+	gallery, err := scanGallery(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
@@ -69,56 +134,367 @@ func (service *GalleryService) ByID(id uuid.UUID) (*Gallery, error) {
 
 		return nil, fmt.Errorf("query gallery by id: %w", err)
 	}
-	return &gallery, nil
+	return gallery, nil
+}
+
+// TitleTaken reports whether userID has a gallery with the given title,
+// including galleries in the trash.
+func (service *GalleryService) TitleTaken(userID uuid.UUID, title string) (bool, error) {
+	var taken bool
+	row := service.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM galleries WHERE user_id = $1 AND title = $2);`, userID, title)
+	err := row.Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("gallery title taken: %w", err)
+	}
+	return taken, nil
+}
+
+// GallerySort is an order for gallery listings.
+type GallerySort string
+
+const (
+	SortNewest  GallerySort = "newest"
+	SortOldest  GallerySort = "oldest"
+	SortUpdated GallerySort = "updated"
+	SortTitle   GallerySort = "title"
+)
+
+// GallerySorts lists the available orders, the default one first.
+var GallerySorts = []GallerySort{SortNewest, SortOldest, SortUpdated, SortTitle}
+
+// ParseGallerySort returns the order named s, or SortNewest for unknown
+// names.
+func ParseGallerySort(s string) GallerySort {
+	for _, sort := range GallerySorts {
+		if string(sort) == s {
+			return sort
+		}
+	}
+	return SortNewest
+}
+
+// keyset returns how to page through galleries in this order.
+func (sort GallerySort) keyset() Keyset {
+	keyset := Keyset{
+		Name:    string(sort),
+		Key:     "galleries.created_at",
+		KeyType: "bigint",
+		ID:      "galleries.id",
+		Desc:    true,
+	}
+	switch sort {
+	case SortOldest:
+		keyset.Desc = false
+	case SortUpdated:
+		keyset.Key = "COALESCE(galleries.updated_at, galleries.created_at)"
+	case SortTitle:
+		keyset.Key = "lower(galleries.title)"
+		keyset.KeyType = "text"
+		keyset.Desc = false
+	}
+	return keyset
+}
+
+// GalleryFilter narrows down gallery listings. The zero value lists
+// everything, newest first.
+type GalleryFilter struct {
+	// Tag keeps galleries tagged with it, or holding images tagged with it.
+	Tag string
+	// CollectionID keeps the galleries of the collection and of its
+	// sub-collections.
+	CollectionID uuid.NullUUID
+	Sort         GallerySort
+}
+
+// where returns the conditions of the filter, numbering its arguments after
+// the ones in args, and the arguments with its own appended.
+func (filter GalleryFilter) where(args []any) (string, []any) {
+	var conditions []string
+	if filter.Tag != "" {
+		args = append(args, filter.Tag)
+		conditions = append(conditions, fmt.Sprintf(`(
+			EXISTS (SELECT 1 FROM gallery_tags JOIN tags ON tags.id = gallery_tags.tag_id
+				WHERE gallery_tags.gallery_id = galleries.id AND tags.name = $%[1]d)
+			OR EXISTS (SELECT 1 FROM image_tags JOIN tags ON tags.id = image_tags.tag_id JOIN images ON images.id = image_tags.image_id
+				WHERE images.gallery_id = galleries.id AND images.deleted_at IS NULL AND tags.name = $%[1]d))`, len(args)))
+	}
+	if filter.CollectionID.Valid {
+		args = append(args, filter.CollectionID.UUID)
+		conditions = append(conditions, fmt.Sprintf(`galleries.id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM collections WHERE id = $%[1]d
+				UNION ALL
+				SELECT collections.id FROM collections JOIN tree ON collections.parent_id = tree.id
+			)
+			SELECT gallery_id FROM collection_galleries WHERE collection_id IN (SELECT id FROM tree))`, len(args)))
+	}
+	if len(conditions) == 0 {
+		return "TRUE", args
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// ByUserID returns a page of the galleries of a user matching filter.
+func (service *GalleryService) ByUserID(userID uuid.UUID, filter GalleryFilter, page PageRequest) ([]Gallery, PageInfo, error) {
+	where, args := filter.where([]any{userID})
+	galleries, info, err := service.queryGalleryPage(`
+		SELECT `+galleryColumns+`, %[1]s
+		FROM galleries
+		WHERE user_id = $1 AND deleted_at IS NULL AND `+where+` AND %[2]s
+		%[3]s;`, filter.Sort.keyset(), page, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("query galleries by user: %w", err)
+	}
+	return galleries, info, nil
+}
+
+// PublicByUserID returns a page of the published galleries of a user, newest
+// first.
+func (service *GalleryService) PublicByUserID(userID uuid.UUID, page PageRequest) ([]Gallery, PageInfo, error) {
+	galleries, info, err := service.queryGalleryPage(`
+		SELECT `+galleryColumns+`, %[1]s
+		FROM galleries
+		WHERE user_id = $1 AND published AND deleted_at IS NULL AND %[2]s
+		%[3]s;`, SortNewest.keyset(), page, userID)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("query public galleries by user: %w", err)
+	}
+	return galleries, info, nil
 }
 
-func (service *GalleryService) ByUserID(userID uuid.UUID) ([]Gallery, error) {
+// Indexable returns the published galleries search engines may list, oldest
+// first, skipping the first offset ones.
+func (service *GalleryService) Indexable(offset, limit int) ([]Gallery, error) {
+	galleries, err := service.queryGalleries(`
+		SELECT `+galleryColumns+`
+		FROM galleries
+		WHERE published AND NOT noindex AND deleted_at IS NULL
+		ORDER BY created_at, id
+		OFFSET $1 LIMIT $2;`, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query indexable galleries: %w", err)
+	}
+	return galleries, nil
+}
+
+// IndexableOwner is a user with galleries search engines may list, and when
+// the latest of them last changed.
+type IndexableOwner struct {
+	UserID  uuid.UUID
+	LastMod int64
+}
+
+// IndexableOwners returns the owners of the galleries listed by Indexable,
+// skipping the first offset ones.
+func (service *GalleryService) IndexableOwners(offset, limit int) ([]IndexableOwner, error) {
 	rows, err := service.DB.Query(`
-		SELECT id, title, created_at, updated_at, published
+		SELECT user_id, MAX(COALESCE(updated_at, created_at))
+		FROM galleries
+		WHERE published AND NOT noindex AND deleted_at IS NULL
+		GROUP BY user_id
+		ORDER BY user_id
+		OFFSET $1 LIMIT $2;`, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query indexable owners: %w", err)
+	}
+	defer rows.Close()
+	var owners []IndexableOwner
+	for rows.Next() {
+		var owner IndexableOwner
+		err := rows.Scan(&owner.UserID, &owner.LastMod)
+		if err != nil {
+			return nil, fmt.Errorf("query indexable owners: %w", err)
+		}
+		owners = append(owners, owner)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query indexable owners: %w", err)
+	}
+	return owners, nil
+}
+
+// CountIndexable returns the number of galleries listed by Indexable and of
+// their owners.
+func (service *GalleryService) CountIndexable() (int, int, error) {
+	var galleries, owners int
+	row := service.DB.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT user_id)
 		FROM galleries
-		WHERE user_id = $1;`, userID)
+		WHERE published AND NOT noindex AND deleted_at IS NULL;`)
+	err := row.Scan(&galleries, &owners)
 	if err != nil {
-		return nil, fmt.Errorf("query galleries by user: %w", err)
+		return 0, 0, fmt.Errorf("count indexable galleries: %w", err)
 	}
+	return galleries, owners, nil
+}
+
+// queryGalleryPage runs query after filling in, in order, the key column of
+// keyset, its condition for page and its ORDER BY and LIMIT clauses.
+func (service *GalleryService) queryGalleryPage(query string, keyset Keyset, page PageRequest, args ...any) ([]Gallery, PageInfo, error) {
+	page = keyset.page(page)
+	where, orderLimit, args := keyset.clauses(page, args)
+	rows, err := service.DB.Query(fmt.Sprintf(query, keyset.columns(), where, orderLimit), args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
 	var galleries []Gallery
+	var cursors []Cursor
 	for rows.Next() {
-		gallery := Gallery{
-			UserID: userID,
+		var key string
+		gallery, err := scanGallery(rowScanner(func(dest ...any) error {
+			return rows.Scan(append(dest, &key)...)
+		}))
+		if err != nil {
+			return nil, PageInfo{}, err
 		}
-		err := rows.Scan(&gallery.ID, &gallery.Title, &gallery.CreatedAt, &gallery.UpdatedAt, &gallery.Public)
+		galleries = append(galleries, *gallery)
+		cursors = append(cursors, keyset.cursor(key, gallery.ID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+	galleries, info := paginate(page, galleries, cursors)
+	return galleries, info, nil
+}
+
+// ByMemberID returns the galleries that userID has joined as a member.
+func (service *GalleryService) ByMemberID(userID uuid.UUID) ([]Gallery, error) {
+	galleries, err := service.queryGalleries(`
+		SELECT `+galleryColumns+`
+		FROM galleries
+			JOIN gallery_members ON gallery_members.gallery_id = galleries.id
+		WHERE gallery_members.user_id = $1 AND gallery_members.accepted_at IS NOT NULL
+			AND galleries.deleted_at IS NULL
+		ORDER BY galleries.title;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query galleries by member: %w", err)
+	}
+	return galleries, nil
+}
+
+// EditableByUserID returns the galleries userID owns or can edit as a
+// member, e.g. to pick where to copy images to.
+func (service *GalleryService) EditableByUserID(userID uuid.UUID) ([]Gallery, error) {
+	galleries, err := service.queryGalleries(`
+		SELECT `+galleryColumns+`
+		FROM galleries
+		WHERE galleries.deleted_at IS NULL AND (galleries.user_id = $1 OR EXISTS (
+			SELECT 1 FROM gallery_members
+			WHERE gallery_members.gallery_id = galleries.id AND gallery_members.user_id = $1
+				AND gallery_members.accepted_at IS NOT NULL AND gallery_members.role IN ($2, $3)))
+		ORDER BY lower(galleries.title), galleries.id;`, userID, RoleEditor, RoleCoOwner)
+	if err != nil {
+		return nil, fmt.Errorf("query editable galleries: %w", err)
+	}
+	return galleries, nil
+}
+
+func (service *GalleryService) queryGalleries(query string, args ...any) ([]Gallery, error) {
+	rows, err := service.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var galleries []Gallery
+	for rows.Next() {
+		gallery, err := scanGallery(rows)
 		if err != nil {
-			return nil, fmt.Errorf("query galleries by user: %w", err)
+			return nil, err
 		}
-		galleries = append(galleries, gallery)
+		galleries = append(galleries, *gallery)
 	}
-	if rows.Err() != nil {
-		return nil, fmt.Errorf("query galleries by user: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 	return galleries, nil
 }
 
+// Update saves the gallery. When the title changes so does the slug, and the
+// former slug keeps leading to the gallery.
 func (service *GalleryService) Update(gallery *Gallery) error {
-	_, err := service.DB.Exec(`
-		UPDATE galleries
-		SET title = $2, updated_at = $3, published = $4
-		WHERE id = $1;`, gallery.ID, gallery.Title, time.Now().Unix(), gallery.Public)
+	var err error
+	for attempt := 0; attempt < slugAttempts; attempt++ {
+		err = service.update(gallery)
+		if !isSlugTaken(err) {
+			break
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("update gallery: %w", err)
 	}
 	return nil
 }
 
+func (service *GalleryService) update(gallery *Gallery) error {
+	slug, err := service.availableSlug(gallery.UserID, Slugify(gallery.Title), gallery.ID)
+	if err != nil {
+		return err
+	}
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		UPDATE galleries
+		SET title = $2, updated_at = $3, published = $4, allow_download = $5,
+			proofing_enabled = $6, selection_limit = $7, comments_enabled = $8, noindex = $9
+		WHERE id = $1;`, gallery.ID, gallery.Title, time.Now().Unix(), gallery.Public, gallery.AllowDownload,
+		gallery.ProofingEnabled, gallery.SelectionLimit, gallery.CommentsEnabled, gallery.NoIndex)
+	if err != nil {
+		return err
+	}
+	err = service.setSlug(tx, gallery, gallery.UserID, slug)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetCover makes imageID the cover of the gallery. A zero imageID clears the
+// cover so the first image is used instead.
+func (service *GalleryService) SetCover(galleryID, imageID uuid.UUID) error {
+	if imageID == uuid.Nil {
+		_, err := service.DB.Exec(`
+			UPDATE galleries
+			SET cover_image_id = NULL, updated_at = $2
+			WHERE id = $1;`, galleryID, time.Now().Unix())
+		if err != nil {
+			return fmt.Errorf("set cover: %w", err)
+		}
+		return nil
+	}
+	res, err := service.DB.Exec(`
+		UPDATE galleries
+		SET cover_image_id = $2, updated_at = $3
+		WHERE id = $1
+			AND EXISTS (SELECT 1 FROM images WHERE images.id = $2 AND images.gallery_id = $1 AND images.deleted_at IS NULL);`,
+		galleryID, imageID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("set cover: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set cover: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("set cover: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// Delete moves a gallery to the trash of its owner. Use PurgeGallery to
+// delete it for good.
 func (service *GalleryService) Delete(id uuid.UUID) error {
 	_, err := service.DB.Exec(`
-		DELETE FROM galleries
-		WHERE id = $1;`, id)
+		UPDATE galleries
+		SET deleted_at = $2
+		WHERE id = $1 AND deleted_at IS NULL;`, id, time.Now().Unix())
 	if err != nil {
 		return fmt.Errorf("delete gallery by id: %w", err)
 	}
-	err = os.RemoveAll(service.galleryDir(id))
-	if err != nil {
-		return fmt.Errorf("delete gallery images: %w", err)
-	}
 	return nil
 }
 
@@ -130,45 +506,155 @@ func (service GalleryService) galleryDir(id uuid.UUID) string {
 	return filepath.Join(imagesDir, "galleries", id.String())
 }
 
+// Image is an uploaded file. Files are stored on disk under their content
+// checksum so user supplied filenames never end up in paths or URLs; the
+// original name is only kept as metadata.
 type Image struct {
-	GalleryID string
-	Path      string
-	Filename  string
+	ID        uuid.UUID `json:"id"`
+	GalleryID string    `json:"gallery_id"`
+	Path      string    `json:"-"`
+	// Filename is the name the file had when it was uploaded.
+	Filename  string `json:"filename"`
+	Checksum  string `json:"checksum"`
+	Extension string `json:"extension"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+	// Position orders the images within the gallery, lowest first.
+	Position int    `json:"position"`
+	Caption  string `json:"caption"`
+	AltText  string `json:"alt_text"`
+	// Edit is applied whenever the image is rendered.
+	Edit ImageEdit `json:"edit"`
+}
+
+// imageColumns lists the columns read by scanImage, in order.
+const imageColumns = `
+	images.id, images.gallery_id, images.filename, images.checksum, images.extension, images.size,
+	images.created_at, images.position, images.caption, images.alt_text,
+	images.rotation, images.flip_horizontal, images.flip_vertical,
+	images.crop_left, images.crop_top, images.crop_right, images.crop_bottom`
+
+func (service *GalleryService) scanImage(row scanner) (*Image, error) {
+	var image Image
+	var galleryID uuid.UUID
+	err := row.Scan(&image.ID, &galleryID, &image.Filename, &image.Checksum, &image.Extension, &image.Size,
+		&image.CreatedAt, &image.Position, &image.Caption, &image.AltText,
+		&image.Edit.Rotation, &image.Edit.FlipHorizontal, &image.Edit.FlipVertical,
+		&image.Edit.Crop.Min.X, &image.Edit.Crop.Min.Y, &image.Edit.Crop.Max.X, &image.Edit.Crop.Max.Y)
+	if err != nil {
+		return nil, err
+	}
+	image.GalleryID = galleryID.String()
+	image.Path = service.imagePath(galleryID, image.Checksum, image.Extension)
+	return &image, nil
 }
 
 func (service *GalleryService) Images(galleryID uuid.UUID) ([]Image, error) {
-	globPattern := filepath.Join(service.galleryDir(galleryID), "*")
-	allFiles, err := filepath.Glob(globPattern)
+	rows, err := service.DB.Query(`
+		SELECT `+imageColumns+`
+		FROM images
+		WHERE gallery_id = $1 AND deleted_at IS NULL
+		ORDER BY position, created_at, filename;`, galleryID)
 	if err != nil {
 		return nil, fmt.Errorf("retrieving gallery images: %w", err)
 	}
+	defer rows.Close()
 	var images []Image
-	for _, file := range allFiles {
-		if hasExtension(file, service.extensions()) {
-			images = append(images, Image{
-				GalleryID: galleryID.String(),
-				Path:      file,
-				Filename:  filepath.Base(file),
-			})
+	for rows.Next() {
+		image, err := service.scanImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("retrieving gallery images: %w", err)
 		}
+		images = append(images, *image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("retrieving gallery images: %w", err)
 	}
 	return images, nil
 }
 
-func (service *GalleryService) Image(galleryID uuid.UUID, filename string) (Image, error) {
-	imagePath := filepath.Join(service.galleryDir(galleryID), filename)
-	_, err := os.Stat(imagePath)
+// ImagesByGalleryIDs returns the first limit images of each of the
+// galleries, in gallery order, with a single query.
+func (service *GalleryService) ImagesByGalleryIDs(galleryIDs []uuid.UUID, limit int) (map[uuid.UUID][]Image, error) {
+	ids := make([]string, len(galleryIDs))
+	for i, id := range galleryIDs {
+		ids[i] = id.String()
+	}
+	rows, err := service.DB.Query(`
+		SELECT `+imageColumns+`
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY gallery_id ORDER BY position, created_at, filename) AS n
+			FROM images
+			WHERE gallery_id = ANY($1::uuid[]) AND deleted_at IS NULL
+		) AS images
+		WHERE n <= $2
+		ORDER BY gallery_id, n;`, ids, limit)
+	if err != nil {
+		return nil, fmt.Errorf("images by gallery ids: %w", err)
+	}
+	defer rows.Close()
+	images := make(map[uuid.UUID][]Image, len(galleryIDs))
+	for rows.Next() {
+		image, err := service.scanImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("images by gallery ids: %w", err)
+		}
+		galleryID, err := uuid.Parse(image.GalleryID)
+		if err != nil {
+			return nil, fmt.Errorf("images by gallery ids: %w", err)
+		}
+		images[galleryID] = append(images[galleryID], *image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("images by gallery ids: %w", err)
+	}
+	return images, nil
+}
+
+// NewestImages returns the latest limit images uploaded to a gallery, newest
+// first.
+func (service *GalleryService) NewestImages(galleryID uuid.UUID, limit int) ([]Image, error) {
+	rows, err := service.DB.Query(`
+		SELECT `+imageColumns+`
+		FROM images
+		WHERE gallery_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC, id
+		LIMIT $2;`, galleryID, limit)
 	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("newest images: %w", err)
+	}
+	defer rows.Close()
+	var images []Image
+	for rows.Next() {
+		image, err := service.scanImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("newest images: %w", err)
+		}
+		images = append(images, *image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("newest images: %w", err)
+	}
+	return images, nil
+}
+
+func (service *GalleryService) Image(galleryID, imageID uuid.UUID) (Image, error) {
+	row := service.DB.QueryRow(`
+		SELECT `+imageColumns+`
+		FROM images
+		WHERE id = $1 AND gallery_id = $2 AND deleted_at IS NULL;`, imageID, galleryID)
+	image, err := service.scanImage(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
 			return Image{}, ErrNotFound
 		}
 		return Image{}, fmt.Errorf("querying for image: %w", err)
 	}
-	return Image{
-		Filename:  filename,
-		GalleryID: galleryID.String(),
-		Path:      imagePath,
-	}, nil
+	return *image, nil
+}
+
+func (service *GalleryService) imagePath(galleryID uuid.UUID, checksum, extension string) string {
+	return filepath.Join(service.galleryDir(galleryID), checksum+extension)
 }
 
 func hasExtension(file string, extensions []string) bool {
@@ -190,42 +676,188 @@ func (service *GalleryService) imageContentTypes() []string {
 	return []string{"image/png", "image/jpeg", "image/gif"}
 }
 
-func (service *GalleryService) CreateImage(galleryID uuid.UUID, filename string, contents io.ReadSeeker) error {
+// CreateImage stores contents in the gallery. The file is named after the
+// SHA-256 checksum of its contents, so uploading the same file twice into a
+// gallery returns ErrDuplicateImage instead of storing another copy.
+func (service *GalleryService) CreateImage(galleryID uuid.UUID, filename string, contents io.ReadSeeker) (*Image, error) {
 	err := checkContentType(contents, service.imageContentTypes())
 	if err != nil {
-		return fmt.Errorf("creating image %v: %w", filename, err)
+		return nil, fmt.Errorf("creating image %v: %w", filename, err)
 	}
-	if !hasExtension(filename, service.extensions()) {
-		return fmt.Errorf("creating image %v: %w", filename, err)
+	err = checkExtension(filename, service.extensions())
+	if err != nil {
+		return nil, fmt.Errorf("creating image %v: %w", filename, err)
 	}
 
 	galleryDir := service.galleryDir(galleryID)
 	err = os.MkdirAll(galleryDir, 0755)
 	if err != nil {
-		return fmt.Errorf("creating gallery-%s images directory: %w", galleryID.String(), err)
+		return nil, fmt.Errorf("creating gallery-%s images directory: %w", galleryID.String(), err)
+	}
+	// Write to a temporary file first, as the final name is only known once
+	// the whole file has been hashed.
+	tmp, err := os.CreateTemp(galleryDir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating image file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), contents)
+	if err != nil {
+		return nil, fmt.Errorf("copying contents to image: %w", err)
 	}
-	imagePath := filepath.Join(galleryDir, filename)
-	dst, err := os.Create(imagePath)
+
+	_, err = tmp.Seek(0, io.SeekStart)
 	if err != nil {
-		return fmt.Errorf("creating image file: %w", err)
+		return nil, fmt.Errorf("reading image file: %w", err)
 	}
-	defer dst.Close()
+	dhash := readDHash(tmp)
 
-	_, err = io.Copy(dst, contents)
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	image := Image{
+		ID:        ID,
+		GalleryID: galleryID.String(),
+		Filename:  filepath.Base(filename),
+		Checksum:  hex.EncodeToString(hash.Sum(nil)),
+		Extension: strings.ToLower(filepath.Ext(filename)),
+		Size:      size,
+		CreatedAt: time.Now().Unix(),
+	}
+	image.Path = service.imagePath(galleryID, image.Checksum, image.Extension)
+	// The row is only committed once the file is in place, so that no image
+	// points to a missing file.
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("creating image %v: %w", filename, err)
+	}
+	defer tx.Rollback()
+	// New images go to the end of the gallery.
+	row := tx.QueryRow(`
+		INSERT INTO images (id, gallery_id, filename, checksum, extension, size, created_at, position, dhash, dhash_failed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7,
+			(SELECT COALESCE(MAX(position) + 1, 0) FROM images WHERE gallery_id = $2), $8, $9)
+		RETURNING position;`,
+		image.ID, galleryID, image.Filename, image.Checksum, image.Extension, image.Size, image.CreatedAt, dhash,
+		!dhash.Valid)
+	err = row.Scan(&image.Position)
+	if err != nil {
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+			// The only unique constraint besides the primary key is the
+			// checksum within a gallery. When the other copy is in the
+			// trash it is restored instead.
+			tx.Rollback()
+			err = service.restoreUpload(&image)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("creating image %v: %w", filename, err)
+		}
+		return &image, nil
+	}
+	err = tmp.Close()
 	if err != nil {
-		return fmt.Errorf("copying contents to image: %w", err)
+		return nil, fmt.Errorf("creating image file: %w", err)
 	}
+	err = os.Rename(tmp.Name(), image.Path)
+	if err != nil {
+		return nil, fmt.Errorf("creating image file: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		os.Remove(image.Path)
+		return nil, fmt.Errorf("creating image %v: %w", filename, err)
+	}
+	return &image, nil
+}
+
+// restoreUpload restores the image in the trash with the checksum of image,
+// at the end of the gallery, and fills in image with it. It returns
+// ErrDuplicateImage when there is no such image.
+func (service *GalleryService) restoreUpload(image *Image) error {
+	row := service.DB.QueryRow(`
+		UPDATE images
+		SET deleted_at = NULL,
+			position = (SELECT COALESCE(MAX(position) + 1, 0) FROM images WHERE gallery_id = $1 AND deleted_at IS NULL)
+		WHERE gallery_id = $1 AND checksum = $2 AND deleted_at IS NOT NULL
+		RETURNING `+imageColumns+`;`, image.GalleryID, image.Checksum)
+	restored, err := service.scanImage(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDuplicateImage
+		}
+		return err
+	}
+	*image = *restored
 	return nil
 }
 
-func (service *GalleryService) DeleteImage(galleryID uuid.UUID, filename string) error {
-	image, err := service.Image(galleryID, filename)
+// DeleteImage moves an image to the trash of the gallery owner. Use
+// PurgeImage to delete it for good.
+func (service *GalleryService) DeleteImage(galleryID, imageID uuid.UUID) error {
+	res, err := service.DB.Exec(`
+		UPDATE images
+		SET deleted_at = $3
+		WHERE id = $1 AND gallery_id = $2 AND deleted_at IS NULL;`, imageID, galleryID, time.Now().Unix())
 	if err != nil {
 		return fmt.Errorf("deleting image: %w", err)
 	}
-	err = os.Remove(image.Path)
+	n, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("deleting image: %w", err)
 	}
+	if n == 0 {
+		return fmt.Errorf("deleting image: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// UpdateImage saves the caption and alt text of an image.
+func (service *GalleryService) UpdateImage(image *Image) error {
+	_, err := service.DB.Exec(`
+		UPDATE images
+		SET caption = $3, alt_text = $4, updated_at = $5
+		WHERE id = $1 AND gallery_id = $2;`,
+		image.ID, image.GalleryID, image.Caption, image.AltText, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("update image: %w", err)
+	}
+	return nil
+}
+
+// ReorderImages sets the position of every image in imageIDs to its index in
+// the slice. IDs that do not belong to the gallery are ignored, and images
+// that are missing from the slice keep their relative order after the ones
+// that were listed.
+func (service *GalleryService) ReorderImages(galleryID uuid.UUID, imageIDs []uuid.UUID) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("reorder images: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		UPDATE images
+		SET position = position + $2
+		WHERE gallery_id = $1;`, galleryID, len(imageIDs))
+	if err != nil {
+		return fmt.Errorf("reorder images: %w", err)
+	}
+	for i, imageID := range imageIDs {
+		_, err = tx.Exec(`
+			UPDATE images
+			SET position = $3
+			WHERE id = $1 AND gallery_id = $2;`, imageID, galleryID, i)
+		if err != nil {
+			return fmt.Errorf("reorder images: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("reorder images: %w", err)
+	}
 	return nil
 }
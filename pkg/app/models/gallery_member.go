@@ -0,0 +1,248 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultInvitationDuration is the default time that an invitation to a
+	// gallery can be accepted for.
+	DefaultInvitationDuration = 7 * 24 * time.Hour
+)
+
+// GalleryRole is what a user may do in a gallery. Every role includes the
+// permissions of the roles before it.
+type GalleryRole string
+
+const (
+	// RoleViewer can see the gallery even when it is not public.
+	RoleViewer GalleryRole = "viewer"
+	// RoleContributor can also upload images.
+	RoleContributor GalleryRole = "contributor"
+	// RoleEditor can also change the gallery details and remove images.
+	RoleEditor GalleryRole = "editor"
+	// RoleCoOwner can do everything the owner can, including deleting the
+	// gallery and managing its members.
+	RoleCoOwner GalleryRole = "co-owner"
+	// RoleOwner is never stored; it is given to the user in galleries.user_id.
+	RoleOwner GalleryRole = "owner"
+)
+
+// GalleryRoles lists the roles that can be given to members.
+var GalleryRoles = []GalleryRole{RoleViewer, RoleContributor, RoleEditor, RoleCoOwner}
+
+func (role GalleryRole) level() int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleContributor:
+		return 2
+	case RoleEditor:
+		return 3
+	case RoleCoOwner:
+		return 4
+	case RoleOwner:
+		return 5
+	}
+	return 0
+}
+
+// Can reports whether role includes the permissions of required.
+func (role GalleryRole) Can(required GalleryRole) bool {
+	return role.level() > 0 && role.level() >= required.level()
+}
+
+// ParseGalleryRole validates a role given to a member.
+func ParseGalleryRole(value string) (GalleryRole, error) {
+	for _, role := range GalleryRoles {
+		if string(role) == value {
+			return role, nil
+		}
+	}
+	return "", ErrInvalidRole
+}
+
+type GalleryMember struct {
+	ID        uuid.UUID     `json:"id"`
+	GalleryID uuid.UUID     `json:"gallery_id"`
+	UserID    uuid.NullUUID `json:"user_id"`
+	Email     string        `json:"email"`
+	Role      GalleryRole   `json:"role"`
+	// Token is only set when an invitation is created.
+	Token     string    `json:"-"`
+	TokenHash string    `json:"-"`
+	InvitedBy uuid.UUID `json:"invited_by"`
+	// ExpiresAt is when the pending invitation can no longer be accepted.
+	ExpiresAt  *int64 `json:"expires_at"`
+	AcceptedAt *int64 `json:"accepted_at"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+type GalleryMemberService struct {
+	DB *sql.DB
+	// BytesPerToken is used to determine how many bytes to use when generating
+	// each invitation token. If this value is not set or is less than the
+	// MinBytesPerToken const it will be ignored and MinBytesPerToken will be
+	// used.
+	BytesPerToken int
+	// Duration is the amount of time that an invitation can be accepted for.
+	// Defaults to DefaultInvitationDuration
+	Duration time.Duration
+}
+
+// Invite creates an invitation for email to join the gallery with the given
+// role. Inviting an address again updates its role and issues a new token.
+func (service *GalleryMemberService) Invite(galleryID uuid.UUID, email string, role GalleryRole, invitedBy uuid.UUID) (*GalleryMember, error) {
+	if _, err := ParseGalleryRole(string(role)); err != nil {
+		return nil, fmt.Errorf("invite member: %w", err)
+	}
+	token, tokenHash, err := TokenManager{BytesPerToken: service.BytesPerToken}.New()
+	if err != nil {
+		return nil, fmt.Errorf("invite member: %w", err)
+	}
+	duration := service.Duration
+	if duration == 0 {
+		duration = DefaultInvitationDuration
+	}
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	expiresAt := time.Now().Add(duration).Unix()
+	member := GalleryMember{
+		ID:        ID,
+		GalleryID: galleryID,
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		Role:      role,
+		Token:     token,
+		TokenHash: tokenHash,
+		InvitedBy: invitedBy,
+		ExpiresAt: &expiresAt,
+		CreatedAt: time.Now().Unix(),
+	}
+	row := service.DB.QueryRow(`
+		INSERT INTO gallery_members (id, gallery_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (gallery_id, email) DO
+		UPDATE SET role = $4, token_hash = $5, invited_by = $6, expires_at = $7, updated_at = $8
+		RETURNING id, user_id, accepted_at;`,
+		member.ID, member.GalleryID, member.Email, member.Role, member.TokenHash, member.InvitedBy,
+		member.ExpiresAt, member.CreatedAt)
+	err = row.Scan(&member.ID, &member.UserID, &member.AcceptedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invite member: %w", err)
+	}
+	return &member, nil
+}
+
+// ByToken returns the pending invitation with the given token. Expired
+// invitations, and invitations to galleries in the trash, are not found.
+func (service *GalleryMemberService) ByToken(token string) (*GalleryMember, error) {
+	member := GalleryMember{
+		TokenHash: TokenManager{}.Hash(token),
+	}
+	row := service.DB.QueryRow(`
+		SELECT gallery_members.id, gallery_members.gallery_id, gallery_members.user_id, gallery_members.email,
+			gallery_members.role, gallery_members.invited_by, gallery_members.accepted_at,
+			gallery_members.expires_at, gallery_members.created_at
+		FROM gallery_members
+			JOIN galleries ON galleries.id = gallery_members.gallery_id
+		WHERE gallery_members.token_hash = $1 AND gallery_members.expires_at > $2
+			AND galleries.deleted_at IS NULL;`, member.TokenHash, time.Now().Unix())
+	err := row.Scan(&member.ID, &member.GalleryID, &member.UserID, &member.Email, &member.Role,
+		&member.InvitedBy, &member.AcceptedAt, &member.ExpiresAt, &member.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("member by token: %w", err)
+	}
+	return &member, nil
+}
+
+// Accept links the invitation to user. The invitation must have been sent to
+// the email address of the user, and its token cannot be used again.
+func (service *GalleryMemberService) Accept(token string, user *User) (*GalleryMember, error) {
+	member, err := service.ByToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("accept invitation: %w", err)
+	}
+	if member.Email != strings.ToLower(user.Email) {
+		return nil, fmt.Errorf("accept invitation: %w", ErrInvitationEmail)
+	}
+	now := time.Now().Unix()
+	_, err = service.DB.Exec(`
+		UPDATE gallery_members
+		SET user_id = $2, accepted_at = $3, token_hash = NULL, expires_at = NULL, updated_at = $3
+		WHERE id = $1;`, member.ID, user.ID, now)
+	if err != nil {
+		return nil, fmt.Errorf("accept invitation: %w", err)
+	}
+	member.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	member.AcceptedAt = &now
+	member.TokenHash = ""
+	member.ExpiresAt = nil
+	return member, nil
+}
+
+// Role returns the role of userID in the gallery, or an empty role when the
+// user is not an accepted member.
+func (service *GalleryMemberService) Role(galleryID, userID uuid.UUID) (GalleryRole, error) {
+	var role GalleryRole
+	row := service.DB.QueryRow(`
+		SELECT role
+		FROM gallery_members
+		WHERE gallery_id = $1 AND user_id = $2 AND accepted_at IS NOT NULL;`, galleryID, userID)
+	err := row.Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("member role: %w", err)
+	}
+	return role, nil
+}
+
+// ByGalleryID returns the members and pending invitations of a gallery.
+func (service *GalleryMemberService) ByGalleryID(galleryID uuid.UUID) ([]GalleryMember, error) {
+	rows, err := service.DB.Query(`
+		SELECT id, user_id, email, role, invited_by, accepted_at, created_at
+		FROM gallery_members
+		WHERE gallery_id = $1
+		ORDER BY created_at;`, galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("query members: %w", err)
+	}
+	defer rows.Close()
+	var members []GalleryMember
+	for rows.Next() {
+		member := GalleryMember{
+			GalleryID: galleryID,
+		}
+		err := rows.Scan(&member.ID, &member.UserID, &member.Email, &member.Role, &member.InvitedBy, &member.AcceptedAt, &member.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query members: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query members: %w", err)
+	}
+	return members, nil
+}
+
+// Remove deletes a member or a pending invitation from the gallery.
+func (service *GalleryMemberService) Remove(galleryID, memberID uuid.UUID) error {
+	_, err := service.DB.Exec(`
+		DELETE FROM gallery_members
+		WHERE id = $1 AND gallery_id = $2;`, memberID, galleryID)
+	if err != nil {
+		return fmt.Errorf("remove member: %w", err)
+	}
+	return nil
+}
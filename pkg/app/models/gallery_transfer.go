@@ -0,0 +1,442 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+)
+
+// Transfer reports what happened to images copied or moved into a gallery.
+type Transfer struct {
+	// Images are the images added to the destination gallery.
+	Images []Image
+	// Skipped are the filenames of the images that were already in the
+	// destination gallery, or in its trash, and were left where they were.
+	Skipped []string
+	// Renamed are the new filenames of the images whose name was already
+	// taken in the destination gallery, e.g. "beach (2).jpg".
+	Renamed []string
+}
+
+// Duplicate copies a gallery, with its settings, tags, collections and
+// images, and returns the copy. The copy starts private so it can be trimmed
+// before it is shared, and its share links, members, selections and
+// comments are not copied.
+func (service *GalleryService) Duplicate(gallery *Gallery) (*Gallery, error) {
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	duplicate := Gallery{
+		ID:              ID,
+		UserID:          gallery.UserID,
+		CreatedAt:       time.Now().Unix(),
+		AllowDownload:   gallery.AllowDownload,
+		ProofingEnabled: gallery.ProofingEnabled,
+		SelectionLimit:  gallery.SelectionLimit,
+		CommentsEnabled: gallery.CommentsEnabled,
+		NoIndex:         gallery.NoIndex,
+	}
+	duplicate.Title, err = service.copyTitle(gallery.UserID, gallery.Title)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate gallery: %w", err)
+	}
+	duplicate.Slug, err = service.availableSlug(duplicate.UserID, Slugify(duplicate.Title), duplicate.ID)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate gallery: %w", err)
+	}
+	images, err := service.Images(gallery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate gallery: %w", err)
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("duplicate gallery: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		INSERT INTO galleries (id, user_id, title, slug, created_at, published, allow_download,
+			proofing_enabled, selection_limit, comments_enabled, noindex)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`,
+		duplicate.ID, duplicate.UserID, duplicate.Title, duplicate.Slug, duplicate.CreatedAt, duplicate.Public,
+		duplicate.AllowDownload, duplicate.ProofingEnabled, duplicate.SelectionLimit, duplicate.CommentsEnabled,
+		duplicate.NoIndex)
+	if err != nil {
+		// Another copy was made with the same title in the meantime.
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.ConstraintName == "galleries_user_id_title_uq" {
+			err = ErrGalleryTitleTaken
+		}
+		return nil, fmt.Errorf("duplicate gallery: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO gallery_tags (gallery_id, tag_id)
+		SELECT $1, tag_id FROM gallery_tags WHERE gallery_id = $2;`, duplicate.ID, gallery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate gallery tags: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO collection_galleries (collection_id, gallery_id)
+		SELECT collection_id, $1 FROM collection_galleries WHERE gallery_id = $2;`, duplicate.ID, gallery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate gallery collections: %w", err)
+	}
+	transfer, _, err := service.transferImages(tx, gallery, &duplicate, images, false)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate gallery: %w", err)
+	}
+	// The copy of the cover is the image with the same contents.
+	for _, image := range images {
+		if !gallery.CoverImageID.Valid || image.ID != gallery.CoverImageID.UUID {
+			continue
+		}
+		for _, copied := range transfer.Images {
+			if copied.Checksum != image.Checksum {
+				continue
+			}
+			_, err = tx.Exec(`
+				UPDATE galleries
+				SET cover_image_id = $2
+				WHERE id = $1;`, duplicate.ID, copied.ID)
+			if err != nil {
+				return nil, fmt.Errorf("duplicate gallery cover: %w", err)
+			}
+			duplicate.CoverImageID = uuid.NullUUID{UUID: copied.ID, Valid: true}
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("duplicate gallery: %w", err)
+	}
+	return &duplicate, nil
+}
+
+// CopyImages copies the images imageIDs of src to the end of dst.
+func (service *GalleryService) CopyImages(src, dst *Gallery, imageIDs []uuid.UUID) (*Transfer, error) {
+	transfer, err := service.transferSelected(src, dst, imageIDs, false)
+	if err != nil {
+		return nil, fmt.Errorf("copy images: %w", err)
+	}
+	return transfer, nil
+}
+
+// MoveImages moves the images imageIDs of src to the end of dst, along with
+// their comments. Images already in dst are left in src.
+func (service *GalleryService) MoveImages(src, dst *Gallery, imageIDs []uuid.UUID) (*Transfer, error) {
+	transfer, err := service.transferSelected(src, dst, imageIDs, true)
+	if err != nil {
+		return nil, fmt.Errorf("move images: %w", err)
+	}
+	return transfer, nil
+}
+
+// Merge moves every image of src to the end of dst and then moves src to
+// the trash. Images that were already in dst stay in src, so they can still
+// be restored from the trash with it.
+func (service *GalleryService) Merge(dst, src *Gallery) (*Transfer, error) {
+	if src.ID == dst.ID {
+		return nil, fmt.Errorf("merge galleries: %w", ErrSameGallery)
+	}
+	images, err := service.Images(src.ID)
+	if err != nil {
+		return nil, fmt.Errorf("merge galleries: %w", err)
+	}
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("merge galleries: %w", err)
+	}
+	defer tx.Rollback()
+	transfer, moved, err := service.transferImages(tx, src, dst, images, true)
+	if err != nil {
+		return nil, fmt.Errorf("merge galleries: %w", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE galleries
+		SET deleted_at = $2
+		WHERE id = $1 AND deleted_at IS NULL;`, src.ID, time.Now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("merge galleries: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("merge galleries: %w", err)
+	}
+	err = removeFiles(moved)
+	if err != nil {
+		return nil, fmt.Errorf("merge galleries: %w", err)
+	}
+	return transfer, nil
+}
+
+// transferSelected copies or moves the images imageIDs of src to dst, in
+// their order in src.
+func (service *GalleryService) transferSelected(src, dst *Gallery, imageIDs []uuid.UUID, move bool) (*Transfer, error) {
+	if src.ID == dst.ID {
+		return nil, ErrSameGallery
+	}
+	selected := map[uuid.UUID]bool{}
+	for _, id := range imageIDs {
+		selected[id] = true
+	}
+	all, err := service.Images(src.ID)
+	if err != nil {
+		return nil, err
+	}
+	var images []Image
+	for _, image := range all {
+		if selected[image.ID] {
+			images = append(images, image)
+		}
+	}
+	if len(images) == 0 {
+		return nil, ErrNoImagesSelected
+	}
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	transfer, moved, err := service.transferImages(tx, src, dst, images, move)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	err = removeFiles(moved)
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// transferImages adds images of src to the end of dst within tx, moving
+// them when move is set and copying them otherwise. Files are copied into
+// dst right away; the paths of the files of moved images are returned for
+// the caller to remove once tx is committed.
+//
+// Images whose contents are already in dst, even in its trash, are skipped,
+// and images whose filename is taken in dst are renamed "name (2).ext",
+// "name (3).ext" and so on. Image tags belong to the gallery owner, so they
+// are only kept when both galleries have the same owner.
+func (service *GalleryService) transferImages(tx *sql.Tx, src, dst *Gallery, images []Image, move bool) (*Transfer, []string, error) {
+	checksums := map[string]bool{}
+	filenames := map[string]bool{}
+	rows, err := tx.Query(`
+		SELECT checksum, filename, deleted_at IS NULL
+		FROM images
+		WHERE gallery_id = $1;`, dst.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query destination images: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var checksum, filename string
+		var visible bool
+		err := rows.Scan(&checksum, &filename, &visible)
+		if err != nil {
+			return nil, nil, fmt.Errorf("query destination images: %w", err)
+		}
+		checksums[checksum] = true
+		if visible {
+			filenames[strings.ToLower(filename)] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("query destination images: %w", err)
+	}
+	var position int
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(position) + 1, 0)
+		FROM images
+		WHERE gallery_id = $1;`, dst.ID).Scan(&position)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query destination position: %w", err)
+	}
+	err = os.MkdirAll(service.galleryDir(dst.ID), 0755)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating gallery-%s images directory: %w", dst.ID.String(), err)
+	}
+
+	var transfer Transfer
+	var moved []string
+	sameOwner := src.UserID == dst.UserID
+	for _, image := range images {
+		if checksums[image.Checksum] {
+			transfer.Skipped = append(transfer.Skipped, image.Filename)
+			continue
+		}
+		checksums[image.Checksum] = true
+		filename := AvailableFilename(image.Filename, filenames)
+		if filename != image.Filename {
+			transfer.Renamed = append(transfer.Renamed, filename)
+		}
+		filenames[strings.ToLower(filename)] = true
+
+		added := image
+		added.GalleryID = dst.ID.String()
+		added.Filename = filename
+		added.Position = position
+		added.Path = service.imagePath(dst.ID, image.Checksum, image.Extension)
+		position++
+		err = copyFile(image.Path, added.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("copy image file: %w", err)
+		}
+		if move {
+			err = moveImage(tx, src, &added, sameOwner)
+			if err == nil {
+				var files []string
+				files, err = service.imageFiles(src.ID, src.UserID, image.Checksum, image.Extension)
+				moved = append(moved, files...)
+			}
+		} else {
+			err = copyImage(tx, image.ID, &added, sameOwner)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("transfer image %v: %w", image.Filename, err)
+		}
+		transfer.Images = append(transfer.Images, added)
+	}
+	return &transfer, moved, nil
+}
+
+// moveImage hands image over to the gallery in image.GalleryID. Its comments
+// follow it, while the picks made in the selections of src do not.
+func moveImage(tx *sql.Tx, src *Gallery, image *Image, keepTags bool) error {
+	_, err := tx.Exec(`
+		UPDATE images
+		SET gallery_id = $2, filename = $3, position = $4, updated_at = $5
+		WHERE id = $1;`, image.ID, image.GalleryID, image.Filename, image.Position, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE comments
+		SET gallery_id = $2
+		WHERE image_id = $1;`, image.ID, image.GalleryID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM proofing_picks
+		WHERE image_id = $1;`, image.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE galleries
+		SET cover_image_id = NULL
+		WHERE id = $1 AND cover_image_id = $2;`, src.ID, image.ID)
+	if err != nil {
+		return err
+	}
+	if !keepTags {
+		_, err = tx.Exec(`
+			DELETE FROM image_tags
+			WHERE image_id = $1;`, image.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyImage stores image as a new image copied from the image sourceID, and
+// sets its ID.
+func copyImage(tx *sql.Tx, sourceID uuid.UUID, image *Image, keepTags bool) error {
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	image.ID = ID
+	image.CreatedAt = time.Now().Unix()
+	crop := image.Edit.crop()
+	_, err = tx.Exec(`
+		INSERT INTO images (id, gallery_id, filename, checksum, extension, size, created_at, position, caption, alt_text,
+			rotation, flip_horizontal, flip_vertical, crop_left, crop_top, crop_right, crop_bottom, dhash, dhash_failed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+			(SELECT dhash FROM images WHERE id = $18), (SELECT dhash_failed FROM images WHERE id = $18));`,
+		image.ID, image.GalleryID, image.Filename, image.Checksum, image.Extension, image.Size, image.CreatedAt,
+		image.Position, image.Caption, image.AltText,
+		image.Edit.Rotation, image.Edit.FlipHorizontal, image.Edit.FlipVertical,
+		crop.Min.X, crop.Min.Y, crop.Max.X, crop.Max.Y, sourceID)
+	if err != nil {
+		return err
+	}
+	if keepTags {
+		_, err = tx.Exec(`
+			INSERT INTO image_tags (image_id, tag_id)
+			SELECT $1, tag_id FROM image_tags WHERE image_id = $2;`, image.ID, sourceID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTitle returns the first of "title (copy)", "title (copy 2)"... that
+// is not taken by a gallery of userID, as checked by TitleTaken.
+func (service *GalleryService) copyTitle(userID uuid.UUID, title string) (string, error) {
+	copyTitle := title + " (copy)"
+	for n := 2; ; n++ {
+		taken, err := service.TitleTaken(userID, copyTitle)
+		if err != nil || !taken {
+			return copyTitle, err
+		}
+		copyTitle = fmt.Sprintf("%s (copy %d)", title, n)
+	}
+}
+
+// AvailableFilename returns filename, or the first of "name (2).ext",
+// "name (3).ext"... that is not in taken. Names in taken are lowercase.
+func AvailableFilename(filename string, taken map[string]bool) string {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	name := filename
+	for n := 2; taken[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	return name
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// removeFiles removes the files at paths, ignoring the ones that are already
+// gone.
+func removeFiles(paths []string) error {
+	for _, path := range paths {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
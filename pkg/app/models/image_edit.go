@@ -0,0 +1,326 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/AguilaMike/lenslocked/pkg/internal/imaging"
+	"github.com/google/uuid"
+)
+
+// CropScale is the length of each side of an image in the units crops are
+// given in, so that crops do not depend on the size of the image.
+const CropScale = 10000
+
+// fullCrop keeps the whole image.
+var fullCrop = image.Rect(0, 0, CropScale, CropScale)
+
+// ImageEdit is the edit recipe of an image. Edits never change the uploaded
+// file: whenever the image is rendered it is rotated, then flipped, then
+// cropped. The zero value leaves the image as it was uploaded.
+type ImageEdit struct {
+	// Rotation is 0, 90, 180 or 270 degrees clockwise.
+	Rotation       int  `json:"rotation"`
+	FlipHorizontal bool `json:"flip_horizontal"`
+	FlipVertical   bool `json:"flip_vertical"`
+	// Crop is the part of the rotated and flipped image that is kept, in
+	// CropScale units. An empty crop keeps the whole image.
+	Crop image.Rectangle `json:"crop"`
+}
+
+func (edit ImageEdit) crop() image.Rectangle {
+	if edit.Crop.Empty() {
+		return fullCrop
+	}
+	return edit.Crop
+}
+
+// Edited reports whether the recipe changes the image at all.
+func (edit ImageEdit) Edited() bool {
+	return edit.Rotation != 0 || edit.FlipHorizontal || edit.FlipVertical || edit.crop() != fullCrop
+}
+
+// Size returns the size of an image of width by height pixels once the
+// recipe is applied to it.
+func (edit ImageEdit) Size(width, height int) (int, int) {
+	if edit.Rotation == 90 || edit.Rotation == 270 {
+		width, height = height, width
+	}
+	size := cropBounds(edit.crop(), width, height).Size()
+	return size.X, size.Y
+}
+
+// cropBounds returns the pixels kept by crop of an image of width by height
+// pixels.
+func cropBounds(crop image.Rectangle, width, height int) image.Rectangle {
+	scale := func(v, size int) int {
+		return (v*size + CropScale/2) / CropScale
+	}
+	r := image.Rect(scale(crop.Min.X, width), scale(crop.Min.Y, height), scale(crop.Max.X, width), scale(crop.Max.Y, height))
+	// Tiny crops of small images still keep a pixel.
+	if r.Dx() < 1 {
+		r.Min.X = min(r.Min.X, width-1)
+		r.Max.X = r.Min.X + 1
+	}
+	if r.Dy() < 1 {
+		r.Min.Y = min(r.Min.Y, height-1)
+		r.Max.Y = r.Min.Y + 1
+	}
+	return r
+}
+
+// Rotate turns the image by a quarter, clockwise or not. The crop turns
+// with the image, so that it keeps the same part of the photo.
+func (edit ImageEdit) Rotate(clockwise bool) ImageEdit {
+	crop := edit.crop()
+	if clockwise {
+		edit.Rotation = (edit.Rotation + 90) % 360
+		edit.Crop = image.Rect(CropScale-crop.Max.Y, crop.Min.X, CropScale-crop.Min.Y, crop.Max.X)
+	} else {
+		edit.Rotation = (edit.Rotation + 270) % 360
+		edit.Crop = image.Rect(crop.Min.Y, CropScale-crop.Max.X, crop.Max.Y, CropScale-crop.Min.X)
+	}
+	// Flips are applied after the rotation, and turning a flipped image by
+	// a quarter is the same as turning it, then flipping it the other way.
+	edit.FlipHorizontal, edit.FlipVertical = edit.FlipVertical, edit.FlipHorizontal
+	return edit
+}
+
+// Flip mirrors the image left to right when horizontal is set, or top to
+// bottom otherwise. The crop is mirrored too.
+func (edit ImageEdit) Flip(horizontal bool) ImageEdit {
+	crop := edit.crop()
+	if horizontal {
+		edit.FlipHorizontal = !edit.FlipHorizontal
+		edit.Crop = image.Rect(CropScale-crop.Max.X, crop.Min.Y, CropScale-crop.Min.X, crop.Max.Y)
+	} else {
+		edit.FlipVertical = !edit.FlipVertical
+		edit.Crop = image.Rect(crop.Min.X, CropScale-crop.Max.Y, crop.Max.X, CropScale-crop.Min.Y)
+	}
+	return edit
+}
+
+// CropTo replaces the crop with crop, in CropScale units of the rotated and
+// flipped image.
+func (edit ImageEdit) CropTo(crop image.Rectangle) (ImageEdit, error) {
+	if crop.Empty() || !crop.In(fullCrop) {
+		return edit, ErrInvalidImageEdit
+	}
+	edit.Crop = crop
+	return edit, nil
+}
+
+// CropToAspect replaces the crop with the largest centered rectangle with
+// the aspect ratio ratioWidth:ratioHeight. width and height are the size of
+// the image as it was uploaded.
+func (edit ImageEdit) CropToAspect(width, height, ratioWidth, ratioHeight int) (ImageEdit, error) {
+	if width < 1 || height < 1 || ratioWidth < 1 || ratioHeight < 1 {
+		return edit, ErrInvalidImageEdit
+	}
+	if edit.Rotation == 90 || edit.Rotation == 270 {
+		width, height = height, width
+	}
+	crop := fullCrop
+	if int64(width)*int64(ratioHeight) > int64(height)*int64(ratioWidth) {
+		// Too wide: keep the height and crop the sides.
+		cropWidth := int(int64(height) * int64(ratioWidth) * CropScale / (int64(ratioHeight) * int64(width)))
+		crop.Min.X = (CropScale - cropWidth) / 2
+		crop.Max.X = crop.Min.X + cropWidth
+	} else {
+		cropHeight := int(int64(width) * int64(ratioHeight) * CropScale / (int64(ratioWidth) * int64(height)))
+		crop.Min.Y = (CropScale - cropHeight) / 2
+		crop.Max.Y = crop.Min.Y + cropHeight
+	}
+	return edit.CropTo(crop)
+}
+
+func (edit ImageEdit) validate() error {
+	switch edit.Rotation {
+	case 0, 90, 180, 270:
+	default:
+		return ErrInvalidImageEdit
+	}
+	crop := edit.crop()
+	if !crop.In(fullCrop) {
+		return ErrInvalidImageEdit
+	}
+	return nil
+}
+
+// apply renders the recipe on img.
+func (edit ImageEdit) apply(img image.Image) image.Image {
+	if edit.Rotation != 0 {
+		img = imaging.Rotate(img, edit.Rotation)
+	}
+	if edit.FlipHorizontal {
+		img = imaging.Flip(img, true)
+	}
+	if edit.FlipVertical {
+		img = imaging.Flip(img, false)
+	}
+	crop := edit.crop()
+	if crop == fullCrop {
+		return img
+	}
+	bounds := img.Bounds()
+	return imaging.Crop(img, cropBounds(crop, bounds.Dx(), bounds.Dy()))
+}
+
+// fingerprint identifies the recipe, so that rendered images are generated
+// again whenever it changes.
+func (edit ImageEdit) fingerprint() string {
+	crop := edit.crop()
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\x00%t\x00%t\x00%d\x00%d\x00%d\x00%d", edit.Rotation, edit.FlipHorizontal, edit.FlipVertical,
+		crop.Min.X, crop.Min.Y, crop.Max.X, crop.Max.Y)
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// EditImage saves edit as the recipe of image. Saving the zero ImageEdit
+// reverts the image to the way it was uploaded.
+func (service *GalleryService) EditImage(image *Image, edit ImageEdit) error {
+	err := edit.validate()
+	if err != nil {
+		return fmt.Errorf("edit image: %w", err)
+	}
+	edit.Crop = edit.crop()
+	result, err := service.DB.Exec(`
+		UPDATE images
+		SET rotation = $3, flip_horizontal = $4, flip_vertical = $5,
+			crop_left = $6, crop_top = $7, crop_right = $8, crop_bottom = $9, updated_at = $10
+		WHERE id = $1 AND gallery_id = $2 AND deleted_at IS NULL;`,
+		image.ID, image.GalleryID, edit.Rotation, edit.FlipHorizontal, edit.FlipVertical,
+		edit.Crop.Min.X, edit.Crop.Min.Y, edit.Crop.Max.X, edit.Crop.Max.Y, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("edit image: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("edit image: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	image.Edit = edit
+	return nil
+}
+
+// ImageDimensions returns the width and height of img as it was uploaded.
+func (service *GalleryService) ImageDimensions(img Image) (int, int, error) {
+	file, err := os.Open(img.Path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("image dimensions: %w", err)
+	}
+	defer file.Close()
+	width, height, err := imaging.Dimensions(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("image dimensions: %w", err)
+	}
+	return width, height, nil
+}
+
+// editsDir holds the edited renditions of the images of a gallery.
+func (service *GalleryService) editsDir(galleryID uuid.UUID) string {
+	return filepath.Join(service.galleryDir(galleryID), "edits")
+}
+
+// imageFiles returns the paths of the file of an image and of its edited
+// renditions, and of the copies marked with the watermark of userID, the
+// owner of its gallery.
+func (service *GalleryService) imageFiles(galleryID, userID uuid.UUID, checksum, extension string) ([]string, error) {
+	edits, err := filepath.Glob(filepath.Join(service.editsDir(galleryID), checksum+"-*"))
+	if err != nil {
+		return nil, err
+	}
+	marked, err := service.watermarkedFiles(userID, checksum)
+	if err != nil {
+		return nil, err
+	}
+	files := append([]string{service.imagePath(galleryID, checksum, extension)}, edits...)
+	return append(files, marked...), nil
+}
+
+// watermarkedFiles returns the paths of the copies of the image with
+// checksum marked with the watermark of userID. The copies are shared by the
+// images of userID with the same contents, and are generated again by those
+// still in use.
+func (service *GalleryService) watermarkedFiles(userID uuid.UUID, checksum string) ([]string, error) {
+	watermarks := WatermarkService{ImagesDir: service.ImagesDir}
+	return filepath.Glob(filepath.Join(watermarks.cacheDir(userID), checksum+"-*"))
+}
+
+// EditedImagePath returns the path of img with its edit recipe applied: the
+// file itself when it was not edited, or a rendition that is generated on
+// first use and kept until the recipe changes. Animated GIFs only keep their
+// first frame once edited.
+func (service *GalleryService) EditedImagePath(img Image) (string, error) {
+	if !img.Edit.Edited() {
+		return img.Path, nil
+	}
+	galleryID, err := uuid.Parse(img.GalleryID)
+	if err != nil {
+		return "", fmt.Errorf("edited image: %w", err)
+	}
+	path := filepath.Join(service.editsDir(galleryID), img.Checksum+"-"+img.Edit.fingerprint()+img.Extension)
+	_, err = os.Stat(path)
+	if err == nil {
+		return path, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("edited image: %w", err)
+	}
+	rendered, format, err := renderImage(img)
+	if err != nil {
+		return "", fmt.Errorf("edited image: %w", err)
+	}
+	err = writeRendition(path, rendered, format)
+	if err != nil {
+		return "", fmt.Errorf("edited image: %w", err)
+	}
+	return path, nil
+}
+
+// renderImage decodes the file of img and applies its edit recipe.
+func renderImage(img Image) (image.Image, string, error) {
+	file, err := os.Open(img.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	decoded, format, err := imaging.Decode(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return img.Edit.apply(decoded), format, nil
+}
+
+// writeRendition encodes img to path. Concurrent requests for the same
+// rendition each write their own file, and the last rename wins.
+func writeRendition(path string, img image.Image, format string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "render-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	err = imaging.Encode(tmp, img, format)
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testImage returns an image of width by height pixels whose pixels tell
+// where they were: red is x and green is y.
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+	return img
+}
+
+// region returns where the pixels of img, rendered from an image made by
+// testImage, were in that image.
+func region(img image.Image) map[image.Point]bool {
+	points := map[image.Point]bool{}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			points[image.Pt(int(c.R), int(c.G))] = true
+		}
+	}
+	return points
+}
+
+func sameRegion(a, b map[image.Point]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p := range a {
+		if !b[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// testEdits are recipes to start from.
+var testEdits = []ImageEdit{
+	{},
+	{Crop: image.Rect(1000, 2000, 6000, 9000)},
+	{Rotation: 90, Crop: image.Rect(0, 0, 5000, 2500)},
+	{Rotation: 180, FlipHorizontal: true, Crop: image.Rect(2500, 0, 10000, 7500)},
+	{Rotation: 270, FlipVertical: true, Crop: image.Rect(3000, 3000, 7000, 7000)},
+	{FlipHorizontal: true, FlipVertical: true},
+}
+
+func TestImageEditRotateFullTurn(t *testing.T) {
+	for _, edit := range testEdits {
+		for _, clockwise := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%+v clockwise %v", edit, clockwise), func(t *testing.T) {
+				got := edit
+				for i := 0; i < 4; i++ {
+					got = got.Rotate(clockwise)
+				}
+				if got.Rotation != edit.Rotation || got.FlipHorizontal != edit.FlipHorizontal ||
+					got.FlipVertical != edit.FlipVertical || got.crop() != edit.crop() {
+					t.Errorf("four rotations = %+v, want %+v", got, edit)
+				}
+				if got.Edited() != edit.Edited() {
+					t.Errorf("Edited() = %v, want %v", got.Edited(), edit.Edited())
+				}
+			})
+		}
+	}
+}
+
+func TestImageEditKeepsRegion(t *testing.T) {
+	img := testImage(40, 20)
+	steps := []struct {
+		name string
+		step func(ImageEdit) ImageEdit
+	}{
+		{"rotate clockwise", func(edit ImageEdit) ImageEdit { return edit.Rotate(true) }},
+		{"rotate counterclockwise", func(edit ImageEdit) ImageEdit { return edit.Rotate(false) }},
+		{"flip horizontal", func(edit ImageEdit) ImageEdit { return edit.Flip(true) }},
+		{"flip vertical", func(edit ImageEdit) ImageEdit { return edit.Flip(false) }},
+		{"rotate then flip", func(edit ImageEdit) ImageEdit { return edit.Rotate(true).Flip(true) }},
+		{"flip then rotate", func(edit ImageEdit) ImageEdit { return edit.Flip(false).Rotate(false) }},
+		{"rotate, flip, rotate", func(edit ImageEdit) ImageEdit { return edit.Rotate(true).Flip(false).Rotate(true) }},
+	}
+	for _, edit := range testEdits {
+		want := region(edit.apply(img))
+		for _, step := range steps {
+			t.Run(fmt.Sprintf("%+v %s", edit, step.name), func(t *testing.T) {
+				got := step.step(edit)
+				if !sameRegion(region(got.apply(img)), want) {
+					t.Errorf("%+v keeps another part of the image than %+v", got, edit)
+				}
+			})
+		}
+	}
+}
+
+func TestImageEditCropToAspect(t *testing.T) {
+	tests := []struct {
+		width, height           int
+		rotation                int
+		ratioWidth, ratioHeight int
+		wantWidth, wantHeight   int
+	}{
+		{400, 200, 0, 1, 1, 200, 200},
+		{400, 200, 90, 1, 1, 200, 200},
+		{400, 200, 0, 3, 2, 300, 200},
+		{400, 200, 90, 3, 2, 200, 133},
+		{400, 200, 270, 2, 3, 200, 300},
+		{300, 400, 180, 16, 9, 300, 169},
+		{300, 400, 90, 16, 9, 400, 225},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%dx%d rotated %d to %d:%d", tt.width, tt.height, tt.rotation, tt.ratioWidth, tt.ratioHeight)
+		t.Run(name, func(t *testing.T) {
+			edit, err := ImageEdit{Rotation: tt.rotation}.CropToAspect(tt.width, tt.height, tt.ratioWidth, tt.ratioHeight)
+			if err != nil {
+				t.Fatalf("CropToAspect() err = %v", err)
+			}
+			got := edit.apply(image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))).Bounds()
+			// Crops are rounded to whole pixels.
+			if abs(got.Dx()-tt.wantWidth) > 1 || abs(got.Dy()-tt.wantHeight) > 1 {
+				t.Errorf("rendered %dx%d, want %dx%d", got.Dx(), got.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func TestImageEditSize(t *testing.T) {
+	crops := []image.Rectangle{
+		{},
+		image.Rect(1000, 2000, 6000, 9000),
+		image.Rect(3333, 3333, 6667, 6667),
+		image.Rect(1, 1, 2, 2),
+		image.Rect(9999, 9999, 10000, 10000),
+		image.Rect(0, 4950, 10000, 5050),
+		image.Rect(1250, 0, 1750, 10000),
+	}
+	sizes := []image.Point{{1, 1}, {3, 7}, {40, 20}, {101, 67}, {640, 480}}
+	for _, crop := range crops {
+		for _, rotation := range []int{0, 90, 180, 270} {
+			edit := ImageEdit{Rotation: rotation, FlipHorizontal: rotation == 180, Crop: crop}
+			for _, size := range sizes {
+				t.Run(fmt.Sprintf("%+v %v", edit, size), func(t *testing.T) {
+					width, height := edit.Size(size.X, size.Y)
+					got := edit.apply(image.NewRGBA(image.Rect(0, 0, size.X, size.Y))).Bounds()
+					if width != got.Dx() || height != got.Dy() {
+						t.Errorf("Size() = %dx%d, rendered %dx%d", width, height, got.Dx(), got.Dy())
+					}
+				})
+			}
+		}
+	}
+}
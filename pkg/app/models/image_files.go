@@ -0,0 +1,221 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Before images were kept in the images table, uploads were stored under
+// their original name in the directory of their gallery. ImportImageFiles
+// moves such files to the current layout, and ExportImageFiles moves them
+// back before the images migration is rolled back.
+
+// ImportImageFiles adds the image files of the galleries that are not in the
+// images table yet, at the end of their gallery, and renames them after
+// their checksum as CreateImage does. Files with the same contents as an
+// image already stored are removed. It returns the number of files
+// imported.
+func (service *GalleryService) ImportImageFiles() (int, error) {
+	root := filepath.Dir(service.galleryDir(uuid.Nil))
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("import image files: %w", err)
+	}
+	imported := 0
+	for _, entry := range entries {
+		galleryID, err := uuid.Parse(entry.Name())
+		if !entry.IsDir() || err != nil {
+			continue
+		}
+		n, err := service.importGalleryFiles(galleryID)
+		imported += n
+		if err != nil {
+			return imported, fmt.Errorf("import image files: %w", err)
+		}
+	}
+	return imported, nil
+}
+
+// importGalleryFiles imports the files of a gallery that are not stored
+// images.
+func (service *GalleryService) importGalleryFiles(galleryID uuid.UUID) (int, error) {
+	var exists bool
+	err := service.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM galleries WHERE id = $1);`, galleryID).Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+	rows, err := service.DB.Query(`
+		SELECT checksum, extension
+		FROM images
+		WHERE gallery_id = $1;`, galleryID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	stored := map[string]bool{}
+	for rows.Next() {
+		var checksum, extension string
+		err := rows.Scan(&checksum, &extension)
+		if err != nil {
+			return 0, err
+		}
+		stored[checksum+extension] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	files, err := os.ReadDir(service.galleryDir(galleryID))
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	for _, file := range files {
+		if file.IsDir() || stored[file.Name()] || !hasExtension(file.Name(), service.extensions()) {
+			continue
+		}
+		err = service.importFile(galleryID, file.Name())
+		if err != nil {
+			return imported, fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+// importFile adds the file named filename in the directory of a gallery to
+// its images.
+func (service *GalleryService) importFile(galleryID uuid.UUID, filename string) error {
+	path := filepath.Join(service.galleryDir(galleryID), filename)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	extension := strings.ToLower(filepath.Ext(filename))
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`
+		INSERT INTO images (id, gallery_id, filename, checksum, extension, size, created_at, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7,
+			(SELECT COALESCE(MAX(position) + 1, 0) FROM images WHERE gallery_id = $2))
+		ON CONFLICT (gallery_id, checksum) DO NOTHING;`,
+		uuid.New(), galleryID, filename, checksum, extension, info.Size(), info.ModTime().Unix())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// The gallery already has an image with these contents.
+		err = tx.QueryRow(`
+			SELECT extension
+			FROM images
+			WHERE gallery_id = $1 AND checksum = $2;`, galleryID, checksum).Scan(&extension)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stat(service.imagePath(galleryID, checksum, extension))
+		if err == nil {
+			return os.Remove(path)
+		}
+	}
+	dst := service.imagePath(galleryID, checksum, extension)
+	err = os.Rename(path, dst)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		os.Rename(dst, path)
+		return err
+	}
+	return nil
+}
+
+// ExportImageFiles renames the files of all images, trashed ones included,
+// back to their original names, made unique within their gallery. Run it
+// before rolling back the images migration: captions, edits and everything
+// else kept about images is lost. It returns the number of files renamed.
+func (service *GalleryService) ExportImageFiles() (int, error) {
+	rows, err := service.DB.Query(`
+		SELECT gallery_id, filename, checksum, extension
+		FROM images
+		ORDER BY gallery_id, position, created_at;`)
+	if err != nil {
+		return 0, fmt.Errorf("export image files: %w", err)
+	}
+	defer rows.Close()
+	type file struct {
+		galleryID uuid.UUID
+		filename  string
+		path      string
+	}
+	var files []file
+	for rows.Next() {
+		var f file
+		var checksum, extension string
+		err := rows.Scan(&f.galleryID, &f.filename, &checksum, &extension)
+		if err != nil {
+			return 0, fmt.Errorf("export image files: %w", err)
+		}
+		f.path = service.imagePath(f.galleryID, checksum, extension)
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("export image files: %w", err)
+	}
+	rows.Close()
+
+	exported := 0
+	taken := map[string]bool{}
+	var galleryID uuid.UUID
+	for _, f := range files {
+		if f.galleryID != galleryID {
+			galleryID = f.galleryID
+			taken = map[string]bool{}
+		}
+		_, err := os.Stat(f.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		name := AvailableFilename(filepath.Base(f.filename), taken)
+		taken[strings.ToLower(name)] = true
+		err = os.Rename(f.path, filepath.Join(service.galleryDir(f.galleryID), name))
+		if err != nil {
+			return exported, fmt.Errorf("export image files: %w", err)
+		}
+		exported++
+	}
+	return exported, nil
+}
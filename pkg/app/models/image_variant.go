@@ -0,0 +1,120 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/AguilaMike/lenslocked/pkg/internal/imaging"
+)
+
+// ImageSize selects which rendition of an image is written.
+type ImageSize string
+
+const (
+	// ImageSizeOriginal is the file exactly as it was uploaded.
+	ImageSizeOriginal ImageSize = "original"
+	// ImageSizeWeb is a downscaled copy suitable for screens and sharing,
+	// with the edits of the image applied.
+	ImageSizeWeb ImageSize = "web"
+
+	// WebImageMaxSize is the longest edge, in pixels, of a web-sized image.
+	WebImageMaxSize = 2048
+)
+
+// ParseImageSize converts a user supplied value into an ImageSize, falling
+// back to ImageSizeOriginal for anything it does not recognise.
+func ParseImageSize(value string) ImageSize {
+	if ImageSize(value) == ImageSizeWeb {
+		return ImageSizeWeb
+	}
+	return ImageSizeOriginal
+}
+
+// WriteImage writes the requested rendition of image to w.
+func (service *GalleryService) WriteImage(w io.Writer, image Image, size ImageSize) error {
+	file, err := os.Open(image.Path)
+	if err != nil {
+		return fmt.Errorf("write image: %w", err)
+	}
+	defer file.Close()
+
+	if size == ImageSizeOriginal {
+		_, err = io.Copy(w, file)
+		if err != nil {
+			return fmt.Errorf("write image: %w", err)
+		}
+		return nil
+	}
+
+	img, format, err := imaging.Decode(file)
+	if err != nil {
+		return fmt.Errorf("write image: %w", err)
+	}
+	if format == "gif" && !image.Edit.Edited() {
+		// Re-encoding would drop every frame but the first, so animated gifs
+		// are served as uploaded unless they were edited.
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return fmt.Errorf("write image: %w", err)
+		}
+		_, err = io.Copy(w, file)
+		if err != nil {
+			return fmt.Errorf("write image: %w", err)
+		}
+		return nil
+	}
+	img = image.Edit.apply(img)
+	img = imaging.Fit(img, WebImageMaxSize, WebImageMaxSize)
+	err = imaging.Encode(w, img, format)
+	if err != nil {
+		return fmt.Errorf("write image: %w", err)
+	}
+	return nil
+}
+
+// imageVersionKey computes the versionKey of an image in SQL.
+const imageVersionKey = `concat_ws(':', images.checksum, images.rotation,
+	images.flip_horizontal::int, images.flip_vertical::int,
+	images.crop_left, images.crop_top, images.crop_right, images.crop_bottom)`
+
+// versionKey identifies what the image looks like once rendered: the file it
+// was uploaded as and its edit recipe.
+func (image Image) versionKey() string {
+	crop := image.Edit.crop()
+	flip := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return fmt.Sprintf("%s:%d:%d:%d:%d:%d:%d:%d", image.Checksum, image.Edit.Rotation,
+		flip(image.Edit.FlipHorizontal), flip(image.Edit.FlipVertical),
+		crop.Min.X, crop.Min.Y, crop.Max.X, crop.Max.Y)
+}
+
+// imageVersion hashes the version key of an image together with the version
+// of the watermark drawn on it.
+func imageVersion(key, watermark string) string {
+	hash := sha256.Sum256([]byte(key + "\x00" + watermark))
+	return hex.EncodeToString(hash[:])[:20]
+}
+
+// Version identifies the content of the image as it is served, marked with
+// the watermark of the given Watermark.Version, or "" when it is not. It
+// changes whenever the image is edited or the watermark changes, so it is
+// used in image URLs and as their ETag.
+func (image Image) Version(watermark string) string {
+	return imageVersion(image.versionKey(), watermark)
+}
+
+// ThumbnailVersion is the Version of the thumbnail of the gallery, or "" when
+// it has none.
+func (gallery Gallery) ThumbnailVersion(watermark string) string {
+	if !gallery.thumbnailKey.Valid {
+		return ""
+	}
+	return imageVersion(gallery.thumbnailKey.String, watermark)
+}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+)
+
+const (
+	// DefaultOwnershipTransferDuration is the default time that an
+	// OwnershipTransfer can be accepted for.
+	DefaultOwnershipTransferDuration = 7 * 24 * time.Hour
+)
+
+// OwnershipTransfer is an offer from the owner of a gallery to hand it over
+// to the user with the given email address. A gallery has at most one
+// pending transfer.
+type OwnershipTransfer struct {
+	ID         uuid.UUID `json:"id"`
+	GalleryID  uuid.UUID `json:"gallery_id"`
+	FromUserID uuid.UUID `json:"from_user_id"`
+	// FromEmail is the email address of the owner who started the transfer.
+	FromEmail string `json:"from_email"`
+	Email     string `json:"email"`
+	// Token is only set when a transfer is created.
+	Token     string `json:"-"`
+	TokenHash string `json:"-"`
+	ExpiresAt int64  `json:"expires_at"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type OwnershipTransferService struct {
+	DB *sql.DB
+	// BytesPerToken is used to determine how many bytes to use when generating
+	// each transfer token. If this value is not set or is less than the
+	// MinBytesPerToken const it will be ignored and MinBytesPerToken will be
+	// used.
+	BytesPerToken int
+	// Duration is the amount of time that an OwnershipTransfer can be
+	// accepted for. Defaults to DefaultOwnershipTransferDuration
+	Duration time.Duration
+}
+
+// Create offers the gallery, owned by from, to email. Starting another
+// transfer of the same gallery replaces the pending one.
+func (service *OwnershipTransferService) Create(galleryID uuid.UUID, from *User, email string) (*OwnershipTransfer, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == strings.ToLower(from.Email) {
+		return nil, fmt.Errorf("create ownership transfer: %w", ErrTransferToSelf)
+	}
+	token, tokenHash, err := TokenManager{BytesPerToken: service.BytesPerToken}.New()
+	if err != nil {
+		return nil, fmt.Errorf("create ownership transfer: %w", err)
+	}
+	duration := service.Duration
+	if duration == 0 {
+		duration = DefaultOwnershipTransferDuration
+	}
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	transfer := OwnershipTransfer{
+		ID:         ID,
+		GalleryID:  galleryID,
+		FromUserID: from.ID,
+		FromEmail:  from.Email,
+		Email:      email,
+		Token:      token,
+		TokenHash:  tokenHash,
+		CreatedAt:  time.Now().Unix(),
+		ExpiresAt:  time.Now().Add(duration).Unix(),
+	}
+	row := service.DB.QueryRow(`
+		INSERT INTO ownership_transfers (id, gallery_id, from_user_id, email, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (gallery_id) DO
+		UPDATE SET from_user_id = $3, email = $4, token_hash = $5, expires_at = $6, updated_at = $7
+		RETURNING id;`,
+		transfer.ID, transfer.GalleryID, transfer.FromUserID, transfer.Email, transfer.TokenHash,
+		transfer.ExpiresAt, transfer.CreatedAt)
+	err = row.Scan(&transfer.ID)
+	if err != nil {
+		return nil, fmt.Errorf("create ownership transfer: %w", err)
+	}
+	return &transfer, nil
+}
+
+const ownershipTransferColumns = `
+	ownership_transfers.id, ownership_transfers.gallery_id, ownership_transfers.from_user_id, users.email,
+	ownership_transfers.email, ownership_transfers.expires_at, ownership_transfers.created_at`
+
+func scanOwnershipTransfer(row scanner) (*OwnershipTransfer, error) {
+	var transfer OwnershipTransfer
+	err := row.Scan(&transfer.ID, &transfer.GalleryID, &transfer.FromUserID, &transfer.FromEmail,
+		&transfer.Email, &transfer.ExpiresAt, &transfer.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// ByToken returns the pending transfer with the given token. Expired
+// transfers are not found.
+func (service *OwnershipTransferService) ByToken(token string) (*OwnershipTransfer, error) {
+	row := service.DB.QueryRow(`
+		SELECT `+ownershipTransferColumns+`
+		FROM ownership_transfers
+			JOIN users ON users.id = ownership_transfers.from_user_id
+		WHERE ownership_transfers.token_hash = $1 AND ownership_transfers.expires_at > $2;`,
+		TokenManager{}.Hash(token), time.Now().Unix())
+	transfer, err := scanOwnershipTransfer(row)
+	if err != nil {
+		return nil, fmt.Errorf("ownership transfer by token: %w", err)
+	}
+	return transfer, nil
+}
+
+// ByGalleryID returns the pending transfer of a gallery.
+func (service *OwnershipTransferService) ByGalleryID(galleryID uuid.UUID) (*OwnershipTransfer, error) {
+	row := service.DB.QueryRow(`
+		SELECT `+ownershipTransferColumns+`
+		FROM ownership_transfers
+			JOIN users ON users.id = ownership_transfers.from_user_id
+		WHERE ownership_transfers.gallery_id = $1 AND ownership_transfers.expires_at > $2;`,
+		galleryID, time.Now().Unix())
+	transfer, err := scanOwnershipTransfer(row)
+	if err != nil {
+		return nil, fmt.Errorf("ownership transfer by gallery: %w", err)
+	}
+	return transfer, nil
+}
+
+// Cancel withdraws the pending transfer of a gallery, if any.
+func (service *OwnershipTransferService) Cancel(galleryID uuid.UUID) error {
+	_, err := service.DB.Exec(`
+		DELETE FROM ownership_transfers
+		WHERE gallery_id = $1;`, galleryID)
+	if err != nil {
+		return fmt.Errorf("cancel ownership transfer: %w", err)
+	}
+	return nil
+}
+
+// Accept makes user the owner of the gallery of the transfer, which must have
+// been sent to their email address. The gallery keeps its title unless a new
+// one is given, and ErrGalleryTitleTaken is returned when user already has a
+// gallery with that title.
+//
+// Tags follow the gallery into the tags of its new owner, while the
+// collections of the former owner no longer list it. The former owner keeps
+// no access to the gallery, and the new owner stops being a member of it.
+func (service *OwnershipTransferService) Accept(token string, user *User, title string) (*Gallery, error) {
+	transfer, err := service.ByToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	if transfer.Email != strings.ToLower(user.Email) {
+		return nil, fmt.Errorf("accept ownership transfer: %w", ErrTransferEmail)
+	}
+	galleries := GalleryService{DB: service.DB}
+	gallery, err := galleries.ByID(transfer.GalleryID)
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	if gallery.UserID != transfer.FromUserID {
+		return nil, fmt.Errorf("accept ownership transfer: %w", ErrNotFound)
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = gallery.Title
+	}
+	// Slugs are unique among the galleries of a user, so the gallery gets a
+	// slug among those of its new owner.
+	slug, err := galleries.availableSlug(user.ID, Slugify(title), gallery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	_, err = tx.Exec(`
+		UPDATE galleries
+		SET user_id = $2, title = $3, updated_at = $4
+		WHERE id = $1;`, gallery.ID, user.ID, title, now)
+	if err != nil {
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+			err = ErrGalleryTitleTaken
+		}
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	err = galleries.setSlug(tx, gallery, user.ID, slug)
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	err = moveTags(tx, gallery.ID, transfer.FromUserID, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer tags: %w", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM collection_galleries
+		WHERE gallery_id = $1;`, gallery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM gallery_members
+		WHERE gallery_id = $1 AND user_id = $2;`, gallery.ID, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM ownership_transfers
+		WHERE id = $1;`, transfer.ID)
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("accept ownership transfer: %w", err)
+	}
+	gallery.UserID = user.ID
+	gallery.Title = title
+	gallery.UpdatedAt = &now
+	return gallery, nil
+}
+
+// moveTags gives the tags of a gallery and its images, which belong to
+// from, to the user to: the tags are linked to the tags of to with the same
+// names, creating them when needed. Tags of from that nothing uses anymore
+// are removed.
+func moveTags(tx *sql.Tx, galleryID, from, to uuid.UUID) error {
+	rows, err := tx.Query(`
+		SELECT tags.id, tags.name
+		FROM tags
+		WHERE tags.user_id = $2 AND (
+			EXISTS (SELECT 1 FROM gallery_tags WHERE gallery_tags.tag_id = tags.id AND gallery_tags.gallery_id = $1)
+			OR EXISTS (
+				SELECT 1 FROM image_tags
+					JOIN images ON images.id = image_tags.image_id
+				WHERE image_tags.tag_id = tags.id AND images.gallery_id = $1));`, galleryID, from)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	tags := map[uuid.UUID]string{}
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		err := rows.Scan(&id, &name)
+		if err != nil {
+			return err
+		}
+		tags[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for oldID, name := range tags {
+		tagID, err := uuid.NewUUID()
+		if err != nil {
+			return fmt.Errorf("%s %w", "error creating uuid", err)
+		}
+		// The no-op update makes RETURNING give the ID of existing tags.
+		row := tx.QueryRow(`
+			INSERT INTO tags (id, user_id, name, created_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id;`, tagID, to, name, now)
+		err = row.Scan(&tagID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			UPDATE gallery_tags
+			SET tag_id = $3
+			WHERE gallery_id = $1 AND tag_id = $2;`, galleryID, oldID, tagID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			UPDATE image_tags
+			SET tag_id = $3
+			FROM images
+			WHERE images.id = image_tags.image_id AND images.gallery_id = $1 AND image_tags.tag_id = $2;`,
+			galleryID, oldID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		DELETE FROM tags
+		WHERE user_id = $1
+			AND NOT EXISTS (SELECT 1 FROM gallery_tags WHERE gallery_tags.tag_id = tags.id)
+			AND NOT EXISTS (SELECT 1 FROM image_tags WHERE image_tags.tag_id = tags.id);`, from)
+	return err
+}
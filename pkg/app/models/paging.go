@@ -0,0 +1,170 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// DefaultPageSize is used when PageRequest.Limit is not set.
+const DefaultPageSize = 20
+
+// Cursor points at an item of a listing, by its sort key and ID. A page
+// requested with a cursor starts right after that item or, when Before is
+// set, ends right before it. Sort names the order the cursor was made in.
+type Cursor struct {
+	Sort   string    `json:"s,omitempty"`
+	Key    string    `json:"k"`
+	ID     uuid.UUID `json:"i"`
+	Before bool      `json:"b,omitempty"`
+}
+
+// Encode returns the cursor in a form fit for URLs.
+func (cursor Cursor) Encode() string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor returned by Cursor.Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	err = json.Unmarshal(b, &cursor)
+	if err != nil || cursor.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// PageRequest asks for a page of a listing. Without a cursor the first page
+// is returned.
+type PageRequest struct {
+	Cursor *Cursor
+	Limit  int
+}
+
+func (page PageRequest) limit() int {
+	if page.Limit <= 0 {
+		return DefaultPageSize
+	}
+	return page.Limit
+}
+
+func (page PageRequest) backwards() bool {
+	return page.Cursor != nil && page.Cursor.Before
+}
+
+// PageInfo holds the encoded cursors of the pages around a page. They are
+// empty when there is no such page.
+type PageInfo struct {
+	Prev string
+	Next string
+}
+
+// Keyset orders a listing by Key and then by ID, so that every item has a
+// unique position, and pages through it with conditions on those columns
+// rather than with offsets. Pages are stable while items are added or
+// removed.
+type Keyset struct {
+	// Name identifies the order in cursors, so that cursors of other orders
+	// are not used.
+	Name string
+	// Key is the SQL expression items are sorted by and KeyType is its SQL
+	// type.
+	Key     string
+	KeyType string
+	// ID is the SQL expression of the unique ID of items.
+	ID   string
+	Desc bool
+}
+
+// columns returns the expressions to select, after the columns of the
+// items, so that paginate can build cursors.
+func (keyset Keyset) columns() string {
+	return fmt.Sprintf("(%s)::text", keyset.Key)
+}
+
+// cursor returns the cursor of an item with the given key and ID.
+func (keyset Keyset) cursor(key string, id uuid.UUID) Cursor {
+	return Cursor{Sort: keyset.Name, Key: key, ID: id}
+}
+
+// page returns page, or the first page when its cursor was made in another
+// order or its key is not of KeyType, as the key could not be compared.
+func (keyset Keyset) page(page PageRequest) PageRequest {
+	if page.Cursor == nil {
+		return page
+	}
+	valid := page.Cursor.Sort == keyset.Name
+	if keyset.KeyType == "bigint" {
+		_, err := strconv.ParseInt(page.Cursor.Key, 10, 64)
+		valid = valid && err == nil
+	}
+	if !valid {
+		page.Cursor = nil
+	}
+	return page
+}
+
+// clauses returns the condition selecting the items of the page and the
+// ORDER BY and LIMIT clauses, numbering arguments after the ones in args,
+// with the arguments appended to args.
+func (keyset Keyset) clauses(page PageRequest, args []any) (string, string, []any) {
+	desc := keyset.Desc
+	if page.backwards() {
+		desc = !desc
+	}
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	orderLimit := fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT %d", keyset.Key, direction, keyset.ID, direction, page.limit()+1)
+	if page.Cursor == nil {
+		return "TRUE", orderLimit, args
+	}
+	operator := ">"
+	if desc {
+		operator = "<"
+	}
+	args = append(args, page.Cursor.Key, page.Cursor.ID)
+	where := fmt.Sprintf("(%s, %s) %s ($%d::%s, $%d::uuid)", keyset.Key, keyset.ID, operator, len(args)-1, keyset.KeyType, len(args))
+	return where, orderLimit, args
+}
+
+// paginate takes the items fetched with the clauses of a Keyset, along with
+// their cursors, and returns the items of the page in order and the cursors
+// of the pages around it.
+func paginate[T any](page PageRequest, items []T, cursors []Cursor) ([]T, PageInfo) {
+	var info PageInfo
+	more := len(items) > page.limit()
+	if more {
+		items = items[:page.limit()]
+		cursors = cursors[:page.limit()]
+	}
+	if page.backwards() {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+			cursors[i], cursors[j] = cursors[j], cursors[i]
+		}
+	}
+	if len(items) == 0 {
+		return items, info
+	}
+	first, last := cursors[0], cursors[len(cursors)-1]
+	first.Before = true
+	// Coming back from a later page, or forward from an earlier one, there
+	// is always a page on the other side.
+	if (page.backwards() && more) || (!page.backwards() && page.Cursor != nil) {
+		info.Prev = first.Encode()
+	}
+	if page.backwards() || more {
+		info.Next = last.Encode()
+	}
+	return items, info
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"encoding/base64"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// listing fetches the items of a page the way the queries built with the
+// clauses of a Keyset do: at most limit+1 items after the cursor, or before
+// it in reverse order when going backwards.
+func listing(keys []int, page PageRequest) ([]int, []Cursor) {
+	var items []int
+	var cursors []Cursor
+	add := func(key int) bool {
+		if len(items) > page.limit() {
+			return false
+		}
+		items = append(items, key)
+		cursors = append(cursors, Cursor{Key: strconv.Itoa(key), ID: uuid.NewSHA1(uuid.Nil, []byte{byte(key)})})
+		return true
+	}
+	if page.backwards() {
+		before, _ := strconv.Atoi(page.Cursor.Key)
+		for i := len(keys) - 1; i >= 0; i-- {
+			if keys[i] < before && !add(keys[i]) {
+				break
+			}
+		}
+		return items, cursors
+	}
+	after := 0
+	if page.Cursor != nil {
+		after, _ = strconv.Atoi(page.Cursor.Key)
+	}
+	for _, key := range keys {
+		if key > after && !add(key) {
+			break
+		}
+	}
+	return items, cursors
+}
+
+// pageKey returns the key of the item an encoded cursor points at, or 0 when
+// there is no cursor, and whether the page ends before that item.
+func pageKey(t *testing.T, encoded string) (int, bool) {
+	t.Helper()
+	if encoded == "" {
+		return 0, false
+	}
+	cursor, err := DecodeCursor(encoded)
+	if err != nil {
+		t.Fatalf("DecodeCursor(%q) err = %v", encoded, err)
+	}
+	key, err := strconv.Atoi(cursor.Key)
+	if err != nil {
+		t.Fatalf("cursor key = %q", cursor.Key)
+	}
+	return key, cursor.Before
+}
+
+func TestPaginate(t *testing.T) {
+	keys := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		name   string
+		keys   []int
+		cursor *Cursor
+		want   []int
+		// prev and next are the keys the cursors of the pages around point
+		// at, 0 when there is no such page.
+		prev, next int
+	}{
+		{name: "first", keys: keys, want: []int{1, 2}, next: 2},
+		{name: "middle", keys: keys, cursor: &Cursor{Key: "2"}, want: []int{3, 4}, prev: 3, next: 4},
+		{name: "last", keys: keys, cursor: &Cursor{Key: "4"}, want: []int{5}, prev: 5},
+		{name: "back to middle", keys: keys, cursor: &Cursor{Key: "5", Before: true}, want: []int{3, 4}, prev: 3, next: 4},
+		{name: "back to first", keys: keys, cursor: &Cursor{Key: "3", Before: true}, want: []int{1, 2}, next: 2},
+		{name: "exactly one page", keys: []int{1, 2}, want: []int{1, 2}},
+		{name: "empty", keys: nil, want: nil},
+		{name: "past the end", keys: keys, cursor: &Cursor{Key: "5"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := PageRequest{Cursor: tt.cursor, Limit: 2}
+			items, cursors := listing(tt.keys, page)
+			got, info := paginate(page, items, cursors)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("items = %v, want %v", got, tt.want)
+			}
+			prev, before := pageKey(t, info.Prev)
+			if prev != tt.prev || (prev != 0 && !before) {
+				t.Errorf("prev = %d (before %v), want %d (before true)", prev, before, tt.prev)
+			}
+			next, before := pageKey(t, info.Next)
+			if next != tt.next || before {
+				t.Errorf("next = %d (before %v), want %d (before false)", next, before, tt.next)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	cursor := Cursor{Sort: "updated", Key: "42", ID: uuid.New(), Before: true}
+	got, err := DecodeCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor(Encode()) err = %v", err)
+	}
+	if *got != cursor {
+		t.Errorf("DecodeCursor(Encode()) = %+v, want %+v", *got, cursor)
+	}
+
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "not base64", input: "not a cursor!"},
+		{name: "not json", input: encode("not json")},
+		{name: "wrong types", input: encode(`{"k":1,"i":"` + uuid.NewString() + `"}`)},
+		{name: "invalid id", input: encode(`{"k":"1","i":"not an id"}`)},
+		{name: "no id", input: encode(`{"k":"1"}`)},
+		{name: "nil id", input: encode(`{"k":"1","i":"` + uuid.Nil.String() + `"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := DecodeCursor(tt.input)
+			if err != ErrInvalidCursor {
+				t.Errorf("DecodeCursor(%q) = %+v, %v, want ErrInvalidCursor", tt.input, cursor, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/google/uuid"
+)
+
+// Selection holds the images a visitor picked from a gallery. Visitors are
+// anonymous, so a selection is identified by a token kept in their browser.
+type Selection struct {
+	ID          uuid.UUID     `json:"id"`
+	GalleryID   uuid.UUID     `json:"gallery_id"`
+	ShareLinkID uuid.NullUUID `json:"share_link_id"`
+	// Token is only set when a Selection is being created.
+	Token       string `json:"-"`
+	ClientName  string `json:"client_name"`
+	ClientEmail string `json:"client_email"`
+	SubmittedAt *int64 `json:"submitted_at"`
+	CreatedAt   int64  `json:"created_at"`
+	Picks       []Pick `json:"picks"`
+}
+
+// Submitted reports whether the visitor sent the selection to the owner.
+// Submitted selections cannot be changed.
+func (selection Selection) Submitted() bool {
+	return selection.SubmittedAt != nil
+}
+
+// Picked reports whether imageID is part of the selection.
+func (selection Selection) Picked(imageID uuid.UUID) bool {
+	_, ok := selection.Pick(imageID)
+	return ok
+}
+
+// Pick returns the pick of imageID, if any.
+func (selection Selection) Pick(imageID uuid.UUID) (Pick, bool) {
+	for _, pick := range selection.Picks {
+		if pick.ImageID == imageID {
+			return pick, true
+		}
+	}
+	return Pick{}, false
+}
+
+type Pick struct {
+	ImageID  uuid.UUID `json:"image_id"`
+	Filename string    `json:"filename"`
+	Note     string    `json:"note"`
+}
+
+type ProofingService struct {
+	DB *sql.DB
+}
+
+// Start creates an empty selection for a new visitor of the gallery.
+func (service *ProofingService) Start(galleryID uuid.UUID, shareLinkID uuid.NullUUID) (*Selection, error) {
+	token, tokenHash, err := TokenManager{}.New()
+	if err != nil {
+		return nil, fmt.Errorf("start selection: %w", err)
+	}
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	selection := Selection{
+		ID:          ID,
+		GalleryID:   galleryID,
+		ShareLinkID: shareLinkID,
+		Token:       token,
+		CreatedAt:   time.Now().Unix(),
+	}
+	_, err = service.DB.Exec(`
+		INSERT INTO proofing_selections (id, gallery_id, share_link_id, token_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5);`, selection.ID, selection.GalleryID, selection.ShareLinkID, tokenHash, selection.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("start selection: %w", err)
+	}
+	return &selection, nil
+}
+
+// ByToken returns the selection of a visitor, with its picks.
+func (service *ProofingService) ByToken(galleryID uuid.UUID, token string) (*Selection, error) {
+	row := service.DB.QueryRow(`
+		SELECT id, share_link_id, client_name, client_email, submitted_at, created_at
+		FROM proofing_selections
+		WHERE gallery_id = $1 AND token_hash = $2;`, galleryID, TokenManager{}.Hash(token))
+	return service.selection(galleryID, row)
+}
+
+// ByID returns a selection of the gallery, with its picks.
+func (service *ProofingService) ByID(galleryID, id uuid.UUID) (*Selection, error) {
+	row := service.DB.QueryRow(`
+		SELECT id, share_link_id, client_name, client_email, submitted_at, created_at
+		FROM proofing_selections
+		WHERE gallery_id = $1 AND id = $2;`, galleryID, id)
+	return service.selection(galleryID, row)
+}
+
+func (service *ProofingService) selection(galleryID uuid.UUID, row *sql.Row) (*Selection, error) {
+	selection := Selection{
+		GalleryID: galleryID,
+	}
+	err := row.Scan(&selection.ID, &selection.ShareLinkID, &selection.ClientName, &selection.ClientEmail,
+		&selection.SubmittedAt, &selection.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query selection: %w", err)
+	}
+	selection.Picks, err = service.picks(selection.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &selection, nil
+}
+
+func (service *ProofingService) picks(selectionID uuid.UUID) ([]Pick, error) {
+	rows, err := service.DB.Query(`
+		SELECT images.id, images.filename, proofing_picks.note
+		FROM proofing_picks
+			JOIN images ON images.id = proofing_picks.image_id
+		WHERE proofing_picks.selection_id = $1 AND images.deleted_at IS NULL
+		ORDER BY images.position, images.created_at;`, selectionID)
+	if err != nil {
+		return nil, fmt.Errorf("query picks: %w", err)
+	}
+	defer rows.Close()
+	var picks []Pick
+	for rows.Next() {
+		var pick Pick
+		err := rows.Scan(&pick.ImageID, &pick.Filename, &pick.Note)
+		if err != nil {
+			return nil, fmt.Errorf("query picks: %w", err)
+		}
+		picks = append(picks, pick)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query picks: %w", err)
+	}
+	return picks, nil
+}
+
+// Submitted returns the submitted selections of a gallery, newest first.
+func (service *ProofingService) Submitted(galleryID uuid.UUID) ([]Selection, error) {
+	rows, err := service.DB.Query(`
+		SELECT id
+		FROM proofing_selections
+		WHERE gallery_id = $1 AND submitted_at IS NOT NULL
+		ORDER BY submitted_at DESC;`, galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("query submitted selections: %w", err)
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		err := rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("query submitted selections: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query submitted selections: %w", err)
+	}
+	var selections []Selection
+	for _, id := range ids {
+		selection, err := service.ByID(galleryID, id)
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, *selection)
+	}
+	return selections, nil
+}
+
+// Toggle adds imageID to the selection, or removes it when it was already
+// picked. Adding fails with ErrSelectionLimit once limit images, not counting
+// those in the trash, are picked; a limit of zero means no limit.
+func (service *ProofingService) Toggle(selection *Selection, imageID uuid.UUID, limit int) error {
+	if selection.Submitted() {
+		return fmt.Errorf("toggle pick: %w", ErrSelectionSubmitted)
+	}
+	if selection.Picked(imageID) {
+		_, err := service.DB.Exec(`
+			DELETE FROM proofing_picks
+			WHERE selection_id = $1 AND image_id = $2;`, selection.ID, imageID)
+		if err != nil {
+			return fmt.Errorf("toggle pick: %w", err)
+		}
+		return nil
+	}
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("toggle pick: %w", err)
+	}
+	defer tx.Rollback()
+	// Locking the selection makes concurrent picks wait, so that together
+	// they cannot go past the limit.
+	var submitted bool
+	row := tx.QueryRow(`
+		SELECT submitted_at IS NOT NULL
+		FROM proofing_selections
+		WHERE id = $1
+		FOR UPDATE;`, selection.ID)
+	err = row.Scan(&submitted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("toggle pick: %w", ErrNotFound)
+		}
+		return fmt.Errorf("toggle pick: %w", err)
+	}
+	if submitted {
+		return fmt.Errorf("toggle pick: %w", ErrSelectionSubmitted)
+	}
+	// Only images of the gallery the selection belongs to can be picked, and
+	// picks of images in the trash do not count towards the limit.
+	res, err := tx.Exec(`
+		INSERT INTO proofing_picks (selection_id, image_id, created_at)
+		SELECT $1, images.id, $4
+		FROM images
+		WHERE images.id = $2 AND images.gallery_id = $3 AND images.deleted_at IS NULL
+			AND ($5 <= 0 OR (
+				SELECT COUNT(*)
+				FROM proofing_picks
+					JOIN images AS picked ON picked.id = proofing_picks.image_id
+				WHERE proofing_picks.selection_id = $1 AND picked.deleted_at IS NULL) < $5)
+		ON CONFLICT DO NOTHING;`, selection.ID, imageID, selection.GalleryID, time.Now().Unix(), limit)
+	if err != nil {
+		return fmt.Errorf("toggle pick: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("toggle pick: %w", err)
+	}
+	if n == 0 && limit > 0 {
+		var picked bool
+		row := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM images WHERE id = $1 AND gallery_id = $2 AND deleted_at IS NULL)
+				AND NOT EXISTS (SELECT 1 FROM proofing_picks WHERE selection_id = $3 AND image_id = $1);`,
+			imageID, selection.GalleryID, selection.ID)
+		err = row.Scan(&picked)
+		if err != nil {
+			return fmt.Errorf("toggle pick: %w", err)
+		}
+		// The image could be picked, so the limit was reached.
+		if picked {
+			return fmt.Errorf("toggle pick: %w", ErrSelectionLimit)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("toggle pick: %w", err)
+	}
+	return nil
+}
+
+// SetNote saves the note of a picked image.
+func (service *ProofingService) SetNote(selection *Selection, imageID uuid.UUID, note string) error {
+	if selection.Submitted() {
+		return fmt.Errorf("set note: %w", ErrSelectionSubmitted)
+	}
+	_, err := service.DB.Exec(`
+		UPDATE proofing_picks
+		SET note = $3, updated_at = $4
+		WHERE selection_id = $1 AND image_id = $2;`, selection.ID, imageID, strings.TrimSpace(note), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("set note: %w", err)
+	}
+	return nil
+}
+
+// Submit sends the selection to the owner. After this it can no longer be
+// changed.
+func (service *ProofingService) Submit(selection *Selection, name, email string) error {
+	if selection.Submitted() {
+		return fmt.Errorf("submit selection: %w", ErrSelectionSubmitted)
+	}
+	if len(selection.Picks) == 0 {
+		return fmt.Errorf("submit selection: %w", ErrSelectionEmpty)
+	}
+	now := time.Now().Unix()
+	res, err := service.DB.Exec(`
+		UPDATE proofing_selections
+		SET client_name = $2, client_email = $3, submitted_at = $4, updated_at = $4
+		WHERE id = $1 AND submitted_at IS NULL;`, selection.ID, name, email, now)
+	if err != nil {
+		return fmt.Errorf("submit selection: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("submit selection: %w", err)
+	}
+	// Another request submitted it in the meantime.
+	if n == 0 {
+		return fmt.Errorf("submit selection: %w", ErrSelectionSubmitted)
+	}
+	selection.ClientName = name
+	selection.ClientEmail = email
+	selection.SubmittedAt = &now
+	return nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// HighlightStart and HighlightStop surround the matching words in
+	// SearchResult.Highlights. They are control characters so they cannot
+	// be mistaken for text typed by users.
+	HighlightStart = "\x01"
+	HighlightStop  = "\x02"
+	// MaxHighlights is the number of highlights returned per result.
+	MaxHighlights = 3
+	// DefaultSearchPerPage is used when SearchQuery.PerPage is not set.
+	DefaultSearchPerPage = 20
+)
+
+// SearchQuery describes a full-text search over galleries.
+type SearchQuery struct {
+	// Text is parsed like web search engines do: words are required,
+	// "quoted text" matches phrases, "or" matches either side and a leading
+	// "-" excludes a word.
+	Text string
+	// UserID limits the search to the galleries of a user. When it is not
+	// set only published galleries are searched.
+	UserID  uuid.NullUUID
+	Page    int
+	PerPage int
+}
+
+type SearchResult struct {
+	Gallery Gallery
+	Rank    float64
+	// Highlights are the texts that matched, best first, with the matching
+	// words between HighlightStart and HighlightStop.
+	Highlights []string
+}
+
+type SearchService struct {
+	DB *sql.DB
+}
+
+// Search returns a page of the galleries matching query, best match first,
+// and whether there are more pages.
+func (service *SearchService) Search(query SearchQuery) ([]SearchResult, bool, error) {
+	perPage := query.PerPage
+	if perPage <= 0 {
+		perPage = DefaultSearchPerPage
+	}
+	page := query.Page
+	if page < 1 {
+		page = 1
+	}
+	args := []any{query.Text, perPage + 1, (page - 1) * perPage}
+	scope := "galleries.published"
+	if query.UserID.Valid {
+		args = append(args, query.UserID.UUID)
+		scope = fmt.Sprintf("galleries.user_id = $%d", len(args))
+	}
+	rows, err := service.DB.Query(`
+		WITH query AS (
+			SELECT websearch_to_tsquery('simple', $1) AS q
+		), matches AS (
+			SELECT search_documents.gallery_id,
+				SUM(ts_rank(search_documents.document, query.q)) AS rank,
+				string_agg(
+					ts_headline('simple', search_documents.body, query.q,
+						'HighlightAll=TRUE, StartSel=' || chr(1) || ', StopSel=' || chr(2)),
+					chr(30) ORDER BY ts_rank(search_documents.document, query.q) DESC) AS highlights
+			FROM search_documents
+				CROSS JOIN query
+				JOIN galleries ON galleries.id = search_documents.gallery_id
+			WHERE search_documents.document @@ query.q AND galleries.deleted_at IS NULL AND `+scope+`
+			GROUP BY search_documents.gallery_id
+		)
+		SELECT `+galleryColumns+`, matches.rank, matches.highlights
+		FROM matches
+			JOIN galleries ON galleries.id = matches.gallery_id
+		ORDER BY matches.rank DESC, galleries.created_at DESC, galleries.id
+		LIMIT $2 OFFSET $3;`, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("search galleries: %w", err)
+	}
+	defer rows.Close()
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		var highlights string
+		gallery, err := scanGallery(rowScanner(func(dest ...any) error {
+			return rows.Scan(append(dest, &result.Rank, &highlights)...)
+		}))
+		if err != nil {
+			return nil, false, fmt.Errorf("search galleries: %w", err)
+		}
+		result.Gallery = *gallery
+		// The same tag can match through the gallery and its images.
+		seen := map[string]bool{}
+		for _, highlight := range strings.Split(highlights, "\x1e") {
+			if seen[highlight] || len(result.Highlights) == MaxHighlights {
+				continue
+			}
+			seen[highlight] = true
+			result.Highlights = append(result.Highlights, highlight)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("search galleries: %w", err)
+	}
+	more := len(results) > perPage
+	if more {
+		results = results[:perPage]
+	}
+	return results, more, nil
+}
+
+// rowScanner turns a function into a scanner, to read extra columns after
+// the ones of scanGallery.
+type rowScanner func(dest ...any) error
+
+func (scan rowScanner) Scan(dest ...any) error {
+	return scan(dest...)
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/AguilaMike/lenslocked/pkg/internal/rand"
+	"github.com/google/uuid"
+)
+
+// ShareLink gives anyone holding its token access to a gallery, whether the
+// gallery is public or not.
+type ShareLink struct {
+	ID        uuid.UUID `json:"id"`
+	GalleryID uuid.UUID `json:"gallery_id"`
+	// Token is stored as is, unlike session tokens, so owners can copy the
+	// link again after creating it.
+	Token         string `json:"token"`
+	Label         string `json:"label"`
+	AllowDownload bool   `json:"allow_download"`
+	ExpiresAt     *int64 `json:"expires_at"`
+	Views         int    `json:"views"`
+	RevokedAt     *int64 `json:"revoked_at"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+// Active reports whether the link can still be used.
+func (link ShareLink) Active() bool {
+	if link.RevokedAt != nil {
+		return false
+	}
+	return link.ExpiresAt == nil || time.Now().Unix() < *link.ExpiresAt
+}
+
+type ShareLinkService struct {
+	DB *sql.DB
+	// BytesPerToken is used to determine how many bytes to use when generating
+	// each share link token. If this value is not set or is less than the
+	// MinBytesPerToken const it will be ignored and MinBytesPerToken will be
+	// used.
+	BytesPerToken int
+}
+
+// Create adds a share link to the gallery. A nil expiresAt means the link
+// never expires.
+func (service *ShareLinkService) Create(galleryID uuid.UUID, label string, allowDownload bool, expiresAt *int64) (*ShareLink, error) {
+	bytesPerToken := service.BytesPerToken
+	if bytesPerToken < MinBytesPerToken {
+		bytesPerToken = MinBytesPerToken
+	}
+	token, err := rand.String(bytesPerToken)
+	if err != nil {
+		return nil, fmt.Errorf("create share link: %w", err)
+	}
+	ID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", "error creating uuid", err)
+	}
+	link := ShareLink{
+		ID:            ID,
+		GalleryID:     galleryID,
+		Token:         token,
+		Label:         label,
+		AllowDownload: allowDownload,
+		ExpiresAt:     expiresAt,
+		CreatedAt:     time.Now().Unix(),
+	}
+	_, err = service.DB.Exec(`
+		INSERT INTO gallery_share_links (id, gallery_id, token, label, allow_download, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		link.ID, link.GalleryID, link.Token, link.Label, link.AllowDownload, link.ExpiresAt, link.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("create share link: %w", err)
+	}
+	return &link, nil
+}
+
+// ByGalleryID returns every link of the gallery, including expired and
+// revoked ones, newest first.
+func (service *ShareLinkService) ByGalleryID(galleryID uuid.UUID) ([]ShareLink, error) {
+	rows, err := service.DB.Query(`
+		SELECT id, token, label, allow_download, expires_at, views, revoked_at, created_at
+		FROM gallery_share_links
+		WHERE gallery_id = $1
+		ORDER BY created_at DESC;`, galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("query share links: %w", err)
+	}
+	defer rows.Close()
+	var links []ShareLink
+	for rows.Next() {
+		link := ShareLink{
+			GalleryID: galleryID,
+		}
+		err := rows.Scan(&link.ID, &link.Token, &link.Label, &link.AllowDownload, &link.ExpiresAt, &link.Views, &link.RevokedAt, &link.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query share links: %w", err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query share links: %w", err)
+	}
+	return links, nil
+}
+
+// Valid returns the active link of the gallery with the given token, or
+// ErrNotFound when there is none.
+func (service *ShareLinkService) Valid(galleryID uuid.UUID, token string) (*ShareLink, error) {
+	link := ShareLink{
+		GalleryID: galleryID,
+		Token:     token,
+	}
+	row := service.DB.QueryRow(`
+		SELECT id, label, allow_download, expires_at, views, revoked_at, created_at
+		FROM gallery_share_links
+		WHERE gallery_id = $1 AND token = $2;`, galleryID, token)
+	err := row.Scan(&link.ID, &link.Label, &link.AllowDownload, &link.ExpiresAt, &link.Views, &link.RevokedAt, &link.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query share link: %w", err)
+	}
+	if !link.Active() {
+		return nil, ErrNotFound
+	}
+	return &link, nil
+}
+
+// CountView records a visit through the link.
+func (service *ShareLinkService) CountView(id uuid.UUID) error {
+	_, err := service.DB.Exec(`
+		UPDATE gallery_share_links
+		SET views = views + 1
+		WHERE id = $1;`, id)
+	if err != nil {
+		return fmt.Errorf("count share link view: %w", err)
+	}
+	return nil
+}
+
+// Revoke disables the link. Revoked links are kept so their view counts
+// remain visible to the owner.
+func (service *ShareLinkService) Revoke(galleryID, id uuid.UUID) error {
+	now := time.Now().Unix()
+	_, err := service.DB.Exec(`
+		UPDATE gallery_share_links
+		SET revoked_at = $3, updated_at = $3
+		WHERE id = $1 AND gallery_id = $2 AND revoked_at IS NULL;`, id, galleryID, now)
+	if err != nil {
+		return fmt.Errorf("revoke share link: %w", err)
+	}
+	return nil
+}
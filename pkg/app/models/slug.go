@@ -0,0 +1,159 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// MaxSlugLength is the maximum length of the part of a slug made from a
+	// title, before any suffix telling galleries apart.
+	MaxSlugLength = 60
+	// DefaultSlug is used for titles without a single letter or digit.
+	DefaultSlug = "gallery"
+)
+
+// slugAttempts is the number of times a slug is picked when other galleries
+// keep taking it between availableSlug and the write.
+const slugAttempts = 3
+
+// Slugify turns a title into the readable part of a URL, made of lowercase
+// letters and digits separated by dashes, e.g. "Boda de María" becomes
+// "boda-de-maria".
+func Slugify(title string) string {
+	stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	title, _, err := transform.String(stripAccents, strings.ToLower(title))
+	if err != nil {
+		title = strings.ToLower(title)
+	}
+	var sb strings.Builder
+	dash := false
+	for _, r := range title {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	slug := sb.String()
+	if len(slug) > MaxSlugLength {
+		slug = strings.TrimRight(slug[:MaxSlugLength], "-")
+	}
+	if slug == "" {
+		return DefaultSlug
+	}
+	return slug
+}
+
+// availableSlug returns the first of base, base-2, base-3... that is not,
+// and was not, the slug of a gallery of userID other than id. Slugs are only
+// unique among the galleries of a user, so they tell nothing about the
+// galleries of anyone else.
+func (service *GalleryService) availableSlug(userID uuid.UUID, base string, id uuid.UUID) (string, error) {
+	rows, err := service.DB.Query(`
+		SELECT slug FROM galleries
+		WHERE user_id = $1 AND (slug = $2 OR slug LIKE $2 || '-%') AND id <> $3
+		UNION
+		SELECT slug FROM gallery_slugs
+		WHERE user_id = $1 AND (slug = $2 OR slug LIKE $2 || '-%') AND gallery_id <> $3;`, userID, base, id)
+	if err != nil {
+		return "", fmt.Errorf("available slug: %w", err)
+	}
+	defer rows.Close()
+	taken := map[string]bool{}
+	for rows.Next() {
+		var slug string
+		err := rows.Scan(&slug)
+		if err != nil {
+			return "", fmt.Errorf("available slug: %w", err)
+		}
+		taken[slug] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("available slug: %w", err)
+	}
+	slug := base
+	for n := 2; taken[slug]; n++ {
+		slug = base + "-" + strconv.Itoa(n)
+	}
+	return slug, nil
+}
+
+// isSlugTaken reports whether err is due to another gallery taking the slug
+// picked by availableSlug before it was saved.
+func isSlugTaken(err error) bool {
+	var pgError *pgconn.PgError
+	return errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation &&
+		pgError.ConstraintName == "galleries_user_id_slug_uq"
+}
+
+// setSlug gives the gallery the slug among the galleries of userID, its
+// owner from then on, keeping its current slug in the history of its current
+// owner so links to it keep working.
+func (service *GalleryService) setSlug(tx *sql.Tx, gallery *Gallery, userID uuid.UUID, slug string) error {
+	if slug == gallery.Slug && userID == gallery.UserID {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO gallery_slugs (user_id, slug, gallery_id, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, slug) DO NOTHING;`, gallery.UserID, gallery.Slug, gallery.ID, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	// Going back to a former slug takes it out of the history.
+	_, err = tx.Exec(`
+		DELETE FROM gallery_slugs
+		WHERE user_id = $1 AND slug = $2 AND gallery_id = $3;`, userID, slug, gallery.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE galleries
+		SET slug = $2
+		WHERE id = $1;`, gallery.ID, slug)
+	if err != nil {
+		return err
+	}
+	gallery.Slug = slug
+	return nil
+}
+
+// BySlug returns the gallery of userID with slug. Galleries are also found
+// by their former slugs, and by the ones they had under a former owner, in
+// which case the owner or the slug of the returned gallery differ from the
+// ones asked for and callers should redirect to them.
+func (service *GalleryService) BySlug(userID uuid.UUID, slug string) (*Gallery, error) {
+	row := service.DB.QueryRow(`
+		SELECT `+galleryColumns+`
+		FROM galleries
+		WHERE deleted_at IS NULL
+			AND ((user_id = $1 AND slug = $2)
+				OR id = (SELECT gallery_id FROM gallery_slugs WHERE user_id = $1 AND slug = $2))
+		ORDER BY user_id = $1 AND slug = $2 DESC
+		LIMIT 1;`, userID, slug)
+	gallery, err := scanGallery(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query gallery by slug: %w", err)
+	}
+	return gallery, nil
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// MaxTagLength is the maximum number of characters in a tag name.
+const MaxTagLength = 50
+
+// Tag labels galleries and images. Tags belong to the owner of what they
+// label, so two users never share a tag.
+type Tag struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	// Uses is the number of galleries and images labelled with the tag. It
+	// is read-only.
+	Uses int `json:"uses"`
+}
+
+// ParseTags splits a comma separated list of tag names. Names are trimmed
+// and lower cased; empty and repeated names are dropped.
+func ParseTags(s string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+		if name == "" || seen[name] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > MaxTagLength {
+			name = string([]rune(name)[:MaxTagLength])
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+type TagService struct {
+	DB *sql.DB
+}
+
+// ByUserID returns the tags of a user, by name.
+func (service *TagService) ByUserID(userID uuid.UUID) ([]Tag, error) {
+	rows, err := service.DB.Query(`
+		SELECT tags.id, tags.name,
+			(SELECT COUNT(*) FROM gallery_tags WHERE gallery_tags.tag_id = tags.id) +
+			(SELECT COUNT(*) FROM image_tags WHERE image_tags.tag_id = tags.id)
+		FROM tags
+		WHERE tags.user_id = $1
+		ORDER BY tags.name;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query tags: %w", err)
+	}
+	defer rows.Close()
+	var tags []Tag
+	for rows.Next() {
+		tag := Tag{
+			UserID: userID,
+		}
+		err := rows.Scan(&tag.ID, &tag.Name, &tag.Uses)
+		if err != nil {
+			return nil, fmt.Errorf("query tags: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query tags: %w", err)
+	}
+	return tags, nil
+}
+
+// GalleryTags returns the tag names of a gallery, by name.
+func (service *TagService) GalleryTags(galleryID uuid.UUID) ([]string, error) {
+	rows, err := service.DB.Query(`
+		SELECT gallery_tags.gallery_id, tags.name
+		FROM gallery_tags
+			JOIN tags ON tags.id = gallery_tags.tag_id
+		WHERE gallery_tags.gallery_id = $1
+		ORDER BY tags.name;`, galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("query gallery tags: %w", err)
+	}
+	names, err := scanTagNames(rows)
+	if err != nil {
+		return nil, err
+	}
+	return names[galleryID], nil
+}
+
+// GalleryTagsByUserID returns the tag names of each gallery owned by userID,
+// by name.
+func (service *TagService) GalleryTagsByUserID(userID uuid.UUID) (map[uuid.UUID][]string, error) {
+	rows, err := service.DB.Query(`
+		SELECT gallery_tags.gallery_id, tags.name
+		FROM gallery_tags
+			JOIN tags ON tags.id = gallery_tags.tag_id
+		WHERE tags.user_id = $1
+		ORDER BY tags.name;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query gallery tags: %w", err)
+	}
+	return scanTagNames(rows)
+}
+
+// ImageTags returns the tag names of each image of the gallery, by name.
+func (service *TagService) ImageTags(galleryID uuid.UUID) (map[uuid.UUID][]string, error) {
+	rows, err := service.DB.Query(`
+		SELECT image_tags.image_id, tags.name
+		FROM image_tags
+			JOIN tags ON tags.id = image_tags.tag_id
+			JOIN images ON images.id = image_tags.image_id
+		WHERE images.gallery_id = $1
+		ORDER BY tags.name;`, galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("query image tags: %w", err)
+	}
+	return scanTagNames(rows)
+}
+
+func scanTagNames(rows *sql.Rows) (map[uuid.UUID][]string, error) {
+	defer rows.Close()
+	names := map[uuid.UUID][]string{}
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		err := rows.Scan(&id, &name)
+		if err != nil {
+			return nil, fmt.Errorf("query tag names: %w", err)
+		}
+		names[id] = append(names[id], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query tag names: %w", err)
+	}
+	return names, nil
+}
+
+// SetGalleryTags replaces the tags of a gallery owned by userID.
+func (service *TagService) SetGalleryTags(userID, galleryID uuid.UUID, names []string) error {
+	err := service.setTags(userID, names, `
+		DELETE FROM gallery_tags
+		WHERE gallery_id = $1;`, `
+		INSERT INTO gallery_tags (gallery_id, tag_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;`, galleryID)
+	if err != nil {
+		return fmt.Errorf("set gallery tags: %w", err)
+	}
+	return nil
+}
+
+// SetImageTags replaces the tags of an image in a gallery owned by userID.
+func (service *TagService) SetImageTags(userID, imageID uuid.UUID, names []string) error {
+	err := service.setTags(userID, names, `
+		DELETE FROM image_tags
+		WHERE image_id = $1;`, `
+		INSERT INTO image_tags (image_id, tag_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;`, imageID)
+	if err != nil {
+		return fmt.Errorf("set image tags: %w", err)
+	}
+	return nil
+}
+
+// setTags runs clear and then link, with the ID of every named tag, in a
+// single transaction. Missing tags are created and tags nothing uses anymore
+// are removed.
+func (service *TagService) setTags(userID uuid.UUID, names []string, clear, link string, id uuid.UUID) error {
+	sort.Strings(names)
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(clear, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, name := range names {
+		tagID, err := uuid.NewUUID()
+		if err != nil {
+			return fmt.Errorf("%s %w", "error creating uuid", err)
+		}
+		// The no-op update makes RETURNING give the ID of existing tags.
+		row := tx.QueryRow(`
+			INSERT INTO tags (id, user_id, name, created_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id;`, tagID, userID, name, now)
+		err = row.Scan(&tagID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(link, id, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		DELETE FROM tags
+		WHERE user_id = $1
+			AND NOT EXISTS (SELECT 1 FROM gallery_tags WHERE gallery_tags.tag_id = tags.id)
+			AND NOT EXISTS (SELECT 1 FROM image_tags WHERE image_tags.tag_id = tags.id);`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,305 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultTrashRetention is used when GalleryService.TrashRetention is not
+// set.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashedGallery is a gallery in the trash.
+type TrashedGallery struct {
+	Gallery
+	DeletedAt int64
+	// ExpiresAt is when the gallery will be purged.
+	ExpiresAt int64
+}
+
+// TrashedImage is an image in the trash.
+type TrashedImage struct {
+	Image
+	GalleryTitle string
+	DeletedAt    int64
+	// ExpiresAt is when the image will be purged.
+	ExpiresAt int64
+}
+
+// Trash holds what a user deleted, most recently deleted first. Images of
+// galleries in the trash are not listed, as they are restored and purged
+// along with their gallery.
+type Trash struct {
+	Galleries []TrashedGallery
+	Images    []TrashedImage
+}
+
+func (service *GalleryService) trashRetention() time.Duration {
+	if service.TrashRetention <= 0 {
+		return DefaultTrashRetention
+	}
+	return service.TrashRetention
+}
+
+func (service *GalleryService) expiresAt(deletedAt int64) int64 {
+	return deletedAt + int64(service.trashRetention()/time.Second)
+}
+
+// Trash returns the galleries of userID in the trash and the images in the
+// trash of their other galleries.
+func (service *GalleryService) Trash(userID uuid.UUID) (*Trash, error) {
+	var trash Trash
+	rows, err := service.DB.Query(`
+		SELECT `+galleryColumns+`, galleries.deleted_at
+		FROM galleries
+		WHERE user_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query trash: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item TrashedGallery
+		gallery, err := scanGallery(rowScanner(func(dest ...any) error {
+			return rows.Scan(append(dest, &item.DeletedAt)...)
+		}))
+		if err != nil {
+			return nil, fmt.Errorf("query trash: %w", err)
+		}
+		item.Gallery = *gallery
+		item.ExpiresAt = service.expiresAt(item.DeletedAt)
+		trash.Galleries = append(trash.Galleries, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query trash: %w", err)
+	}
+
+	rows, err = service.DB.Query(`
+		SELECT `+imageColumns+`, galleries.title, images.deleted_at
+		FROM images
+			JOIN galleries ON galleries.id = images.gallery_id
+		WHERE galleries.user_id = $1 AND galleries.deleted_at IS NULL AND images.deleted_at IS NOT NULL
+		ORDER BY images.deleted_at DESC, images.id;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query trash: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item TrashedImage
+		image, err := service.scanImage(rowScanner(func(dest ...any) error {
+			return rows.Scan(append(dest, &item.GalleryTitle, &item.DeletedAt)...)
+		}))
+		if err != nil {
+			return nil, fmt.Errorf("query trash: %w", err)
+		}
+		item.Image = *image
+		item.ExpiresAt = service.expiresAt(item.DeletedAt)
+		trash.Images = append(trash.Images, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query trash: %w", err)
+	}
+	return &trash, nil
+}
+
+// RestoreGallery takes a gallery of userID out of the trash, along with its
+// images.
+func (service *GalleryService) RestoreGallery(userID, id uuid.UUID) error {
+	res, err := service.DB.Exec(`
+		UPDATE galleries
+		SET deleted_at = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL;`, id, userID)
+	if err != nil {
+		return fmt.Errorf("restore gallery: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("restore gallery: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("restore gallery: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// RestoreImage takes an image out of the trash, back to its place in its
+// gallery. The gallery must belong to userID and not be in the trash.
+func (service *GalleryService) RestoreImage(userID, imageID uuid.UUID) error {
+	res, err := service.DB.Exec(`
+		UPDATE images
+		SET deleted_at = NULL
+		FROM galleries
+		WHERE images.id = $1 AND images.deleted_at IS NOT NULL
+			AND galleries.id = images.gallery_id AND galleries.user_id = $2 AND galleries.deleted_at IS NULL;`,
+		imageID, userID)
+	if err != nil {
+		return fmt.Errorf("restore image: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("restore image: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("restore image: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// PurgeGallery deletes a gallery of userID in the trash for good, along with
+// its images.
+func (service *GalleryService) PurgeGallery(userID, id uuid.UUID) error {
+	rows, err := service.DB.Query(`
+		WITH purged AS (
+			DELETE FROM galleries
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+			RETURNING id, user_id
+		)
+		SELECT purged.id, purged.user_id, images.checksum
+		FROM purged
+		LEFT JOIN images ON images.gallery_id = purged.id;`, id, userID)
+	if err != nil {
+		return fmt.Errorf("purge gallery: %w", err)
+	}
+	n, err := service.removeGalleryFiles(rows)
+	if err != nil {
+		return fmt.Errorf("purge gallery images: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("purge gallery: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// PurgeImage deletes an image in the trash of userID for good.
+func (service *GalleryService) PurgeImage(userID, imageID uuid.UUID) error {
+	rows, err := service.DB.Query(`
+		DELETE FROM images
+		USING galleries
+		WHERE images.id = $1 AND images.deleted_at IS NOT NULL
+			AND galleries.id = images.gallery_id AND galleries.user_id = $2
+		RETURNING images.gallery_id, galleries.user_id, images.checksum, images.extension;`, imageID, userID)
+	if err != nil {
+		return fmt.Errorf("purge image: %w", err)
+	}
+	n, err := service.removeImageFiles(rows)
+	if err != nil {
+		return fmt.Errorf("purge image: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("purge image: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// PurgeExpired deletes for good the galleries and images that have been in
+// the trash for longer than the retention period, and returns how many
+// there were.
+func (service *GalleryService) PurgeExpired() (int, error) {
+	before := time.Now().Add(-service.trashRetention()).Unix()
+	rows, err := service.DB.Query(`
+		WITH purged AS (
+			DELETE FROM galleries
+			WHERE deleted_at < $1
+			RETURNING id, user_id
+		)
+		SELECT purged.id, purged.user_id, images.checksum
+		FROM purged
+		LEFT JOIN images ON images.gallery_id = purged.id;`, before)
+	if err != nil {
+		return 0, fmt.Errorf("purge expired galleries: %w", err)
+	}
+	galleries, err := service.removeGalleryFiles(rows)
+	if err != nil {
+		return 0, fmt.Errorf("purge expired galleries: %w", err)
+	}
+
+	rows, err = service.DB.Query(`
+		DELETE FROM images
+		USING galleries
+		WHERE images.deleted_at < $1 AND galleries.id = images.gallery_id
+		RETURNING images.gallery_id, galleries.user_id, images.checksum, images.extension;`, before)
+	if err != nil {
+		return 0, fmt.Errorf("purge expired images: %w", err)
+	}
+	n, err := service.removeImageFiles(rows)
+	if err != nil {
+		return 0, fmt.Errorf("purge expired images: %w", err)
+	}
+	return galleries + n, nil
+}
+
+// removeGalleryFiles removes the directories of the deleted galleries in
+// rows, read as gallery ID, owner ID and the checksum of each of their
+// images, along with the copies of the images marked with the watermark of
+// their owner. It returns how many galleries there were.
+func (service *GalleryService) removeGalleryFiles(rows *sql.Rows) (int, error) {
+	defer rows.Close()
+	var paths []string
+	galleryIDs := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var galleryID, userID uuid.UUID
+		var checksum sql.NullString
+		err := rows.Scan(&galleryID, &userID, &checksum)
+		if err != nil {
+			return 0, err
+		}
+		galleryIDs[galleryID] = true
+		if !checksum.Valid {
+			continue
+		}
+		marked, err := service.watermarkedFiles(userID, checksum.String)
+		if err != nil {
+			return 0, err
+		}
+		paths = append(paths, marked...)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for id := range galleryIDs {
+		err := os.RemoveAll(service.galleryDir(id))
+		if err != nil {
+			return 0, err
+		}
+	}
+	err := removeFiles(paths)
+	if err != nil {
+		return 0, err
+	}
+	return len(galleryIDs), nil
+}
+
+// removeImageFiles removes the files of the deleted images in rows, read as
+// gallery ID, owner ID, checksum and extension, and returns how many there
+// were.
+func (service *GalleryService) removeImageFiles(rows *sql.Rows) (int, error) {
+	defer rows.Close()
+	var paths []string
+	var n int
+	for rows.Next() {
+		var galleryID, userID uuid.UUID
+		var checksum, extension string
+		err := rows.Scan(&galleryID, &userID, &checksum, &extension)
+		if err != nil {
+			return 0, err
+		}
+		files, err := service.imageFiles(galleryID, userID, checksum, extension)
+		if err != nil {
+			return 0, err
+		}
+		paths = append(paths, files...)
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	err := removeFiles(paths)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -67,6 +67,23 @@ func (us *UserService) Create(email, password string) (*User, error) {
 	return &user, nil
 }
 
+func (us *UserService) ByID(id uuid.UUID) (*User, error) {
+	user := User{
+		ID: id,
+	}
+	row := us.DB.QueryRow(`
+		SELECT email, email_normalized, created_at
+		FROM users WHERE id = $1;`, id)
+	err := row.Scan(&user.Email, &user.EmailNormalized, &user.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("user by id: %w", err)
+	}
+	return &user, nil
+}
+
 func (us UserService) Authenticate(email, password string) (*User, error) {
 	email = strings.ToLower(email)
 	user := User{
@@ -0,0 +1,312 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AguilaMike/lenslocked/pkg/app/errors"
+	"github.com/AguilaMike/lenslocked/pkg/internal/imaging"
+	"github.com/google/uuid"
+)
+
+// WatermarkPosition is where the watermark is drawn on images.
+type WatermarkPosition string
+
+const (
+	WatermarkTopLeft     = WatermarkPosition(imaging.TopLeft)
+	WatermarkTopRight    = WatermarkPosition(imaging.TopRight)
+	WatermarkCenter      = WatermarkPosition(imaging.Center)
+	WatermarkBottomLeft  = WatermarkPosition(imaging.BottomLeft)
+	WatermarkBottomRight = WatermarkPosition(imaging.BottomRight)
+	// WatermarkTile repeats the watermark over the whole image.
+	WatermarkTile = WatermarkPosition(imaging.Tile)
+)
+
+// WatermarkPositions lists the positions users can pick from.
+var WatermarkPositions = []WatermarkPosition{
+	WatermarkTopLeft, WatermarkTopRight, WatermarkCenter, WatermarkBottomLeft, WatermarkBottomRight, WatermarkTile,
+}
+
+// ParseWatermarkPosition validates a position picked by a user.
+func ParseWatermarkPosition(value string) (WatermarkPosition, error) {
+	for _, position := range WatermarkPositions {
+		if string(position) == value {
+			return position, nil
+		}
+	}
+	return "", ErrInvalidWatermark
+}
+
+// Watermark holds how the images of a user are marked when they are served
+// to visitors. Owners and members of a gallery always see clean images.
+type Watermark struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Enabled bool      `json:"enabled"`
+	Text    string    `json:"text"`
+	// LogoChecksum is set when the user uploaded a PNG logo, which is then
+	// drawn instead of the text.
+	LogoChecksum string            `json:"logo_checksum"`
+	Position     WatermarkPosition `json:"position"`
+	// Opacity goes from 0 to 100.
+	Opacity int `json:"opacity"`
+	// Scale is the width of the watermark in percent of the image width.
+	Scale     int    `json:"scale"`
+	UpdatedAt *int64 `json:"updated_at"`
+}
+
+// Active reports whether the watermark has to be drawn.
+func (wm Watermark) Active() bool {
+	return wm.Enabled && (wm.LogoChecksum != "" || strings.TrimSpace(wm.Text) != "")
+}
+
+// Version identifies the look of the watermark as it is drawn on images, to
+// be passed to Image.Version. It is empty when the watermark is not drawn.
+func (wm Watermark) Version() string {
+	if !wm.Active() {
+		return ""
+	}
+	return wm.fingerprint()
+}
+
+// fingerprint identifies the look of the watermark, so that cached images
+// are generated again whenever it changes.
+func (wm Watermark) fingerprint() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%d\x00%d", wm.Text, wm.LogoChecksum, wm.Position, wm.Opacity, wm.Scale)
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+type WatermarkService struct {
+	DB *sql.DB
+
+	// ImagesDir is where logos and watermarked images are stored. If not
+	// set, the "images" directory is used, like the GalleryService does.
+	ImagesDir string
+}
+
+func (service *WatermarkService) imagesDir() string {
+	if service.ImagesDir == "" {
+		return "images"
+	}
+	return service.ImagesDir
+}
+
+func (service *WatermarkService) logoPath(userID uuid.UUID, checksum string) string {
+	return filepath.Join(service.imagesDir(), "watermarks", userID.String(), checksum+".png")
+}
+
+// cacheDir holds the watermarked images of a user.
+func (service *WatermarkService) cacheDir(userID uuid.UUID) string {
+	return filepath.Join(service.imagesDir(), "cache", "watermarks", userID.String())
+}
+
+// ByUserID returns the watermark settings of userID. Users who never saved
+// them get the disabled defaults.
+func (service *WatermarkService) ByUserID(userID uuid.UUID) (*Watermark, error) {
+	wm := Watermark{
+		UserID: userID,
+	}
+	var logoChecksum sql.NullString
+	row := service.DB.QueryRow(`
+		SELECT enabled, text, logo_checksum, position, opacity, scale, updated_at
+		FROM watermarks
+		WHERE user_id = $1;`, userID)
+	err := row.Scan(&wm.Enabled, &wm.Text, &logoChecksum, &wm.Position, &wm.Opacity, &wm.Scale, &wm.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Matches the column defaults.
+			wm.Position = WatermarkBottomRight
+			wm.Opacity = 50
+			wm.Scale = 20
+			return &wm, nil
+		}
+		return nil, fmt.Errorf("watermark by user: %w", err)
+	}
+	wm.LogoChecksum = logoChecksum.String
+	return &wm, nil
+}
+
+// Update saves the settings of the watermark, except for its logo, and
+// drops the images that were marked with the former settings.
+func (service *WatermarkService) Update(wm *Watermark) error {
+	if _, err := ParseWatermarkPosition(string(wm.Position)); err != nil {
+		return fmt.Errorf("update watermark: %w", err)
+	}
+	if wm.Opacity < 0 || wm.Opacity > 100 || wm.Scale < 1 || wm.Scale > 100 {
+		return fmt.Errorf("update watermark: %w", ErrInvalidWatermark)
+	}
+	now := time.Now().Unix()
+	_, err := service.DB.Exec(`
+		INSERT INTO watermarks (user_id, enabled, text, position, opacity, scale, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (user_id) DO
+		UPDATE SET enabled = $2, text = $3, position = $4, opacity = $5, scale = $6, updated_at = $7;`,
+		wm.UserID, wm.Enabled, strings.TrimSpace(wm.Text), wm.Position, wm.Opacity, wm.Scale, now)
+	if err != nil {
+		return fmt.Errorf("update watermark: %w", err)
+	}
+	wm.UpdatedAt = &now
+	return service.clearCache(wm.UserID)
+}
+
+// SetLogo stores contents, which must be a PNG file, as the logo of the
+// watermark of userID.
+func (service *WatermarkService) SetLogo(userID uuid.UUID, contents io.ReadSeeker) error {
+	err := checkContentType(contents, []string{"image/png"})
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	// Logos must decode, or every watermarked image would fail to render.
+	_, _, err = imaging.Decode(contents)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", FileError{Issue: err.Error()})
+	}
+	_, err = contents.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, contents)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	_, err = contents.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	path := service.logoPath(userID, checksum)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	defer file.Close()
+	_, err = io.Copy(file, contents)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	return service.setLogoChecksum(userID, checksum)
+}
+
+// RemoveLogo makes the watermark of userID go back to its text.
+func (service *WatermarkService) RemoveLogo(userID uuid.UUID) error {
+	return service.setLogoChecksum(userID, "")
+}
+
+func (service *WatermarkService) setLogoChecksum(userID uuid.UUID, checksum string) error {
+	wm, err := service.ByUserID(userID)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	if wm.LogoChecksum == checksum {
+		return nil
+	}
+	now := time.Now().Unix()
+	_, err = service.DB.Exec(`
+		INSERT INTO watermarks (user_id, logo_checksum, created_at)
+		VALUES ($1, NULLIF($2, ''), $3) ON CONFLICT (user_id) DO
+		UPDATE SET logo_checksum = NULLIF($2, ''), updated_at = $3;`, userID, checksum, now)
+	if err != nil {
+		return fmt.Errorf("set watermark logo: %w", err)
+	}
+	if wm.LogoChecksum != "" {
+		err = os.Remove(service.logoPath(userID, wm.LogoChecksum))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove watermark logo: %w", err)
+		}
+	}
+	return service.clearCache(userID)
+}
+
+// Logo returns the path of the logo of the watermark, to be shown to its
+// owner.
+func (service *WatermarkService) Logo(wm *Watermark) (string, error) {
+	if wm.LogoChecksum == "" {
+		return "", ErrNotFound
+	}
+	return service.logoPath(wm.UserID, wm.LogoChecksum), nil
+}
+
+func (service *WatermarkService) clearCache(userID uuid.UUID) error {
+	err := os.RemoveAll(service.cacheDir(userID))
+	if err != nil {
+		return fmt.Errorf("clear watermark cache: %w", err)
+	}
+	return nil
+}
+
+// Apply returns the path of image as it is served to visitors of a gallery
+// of the user with the watermark wm: edited and marked with wm, or only
+// edited when wm is not active. Marked images are generated on first use and
+// kept until the watermark or the edits of the image change. Animated GIFs
+// are marked on their first frame only.
+func (service *WatermarkService) Apply(wm *Watermark, image Image) (string, error) {
+	if !wm.Active() {
+		galleries := GalleryService{DB: service.DB, ImagesDir: service.ImagesDir}
+		return galleries.EditedImagePath(image)
+	}
+	name := image.Checksum + "-" + image.Edit.fingerprint() + "-" + wm.fingerprint() + image.Extension
+	path := filepath.Join(service.cacheDir(wm.UserID), name)
+	_, err := os.Stat(path)
+	if err == nil {
+		return path, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("apply watermark: %w", err)
+	}
+	err = service.render(wm, image, path)
+	if err != nil {
+		return "", fmt.Errorf("apply watermark: %w", err)
+	}
+	return path, nil
+}
+
+// Marked returns image as it is served to visitors with the watermark wm,
+// see Apply, for GalleryService.WriteImage to resize.
+func (service *WatermarkService) Marked(wm *Watermark, image Image) (Image, error) {
+	path, err := service.Apply(wm, image)
+	if err != nil {
+		return Image{}, err
+	}
+	image.Path = path
+	// The edits are already applied to the marked image.
+	image.Edit = ImageEdit{}
+	return image, nil
+}
+
+// render writes image, edited and marked with wm, to path.
+func (service *WatermarkService) render(wm *Watermark, image Image, path string) error {
+	img, format, err := renderImage(image)
+	if err != nil {
+		return err
+	}
+	mark := imaging.Text(wm.Text)
+	if wm.LogoChecksum != "" {
+		logo, err := os.Open(service.logoPath(wm.UserID, wm.LogoChecksum))
+		if err != nil {
+			return err
+		}
+		defer logo.Close()
+		mark, _, err = imaging.Decode(logo)
+		if err != nil {
+			return err
+		}
+	}
+	img = imaging.Watermark(img, mark, imaging.Position(wm.Position), float64(wm.Scale)/100, float64(wm.Opacity)/100)
+	return writeRendition(path, img, format)
+}
@@ -3,8 +3,10 @@ package router
 import (
 	"database/sql"
 	"fmt"
+	"net"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/AguilaMike/lenslocked/pkg/app/controllers"
 	"github.com/AguilaMike/lenslocked/pkg/app/models"
@@ -22,6 +24,35 @@ type Config struct {
 	}
 	Server struct {
 		Address string
+		// BaseURL is the public address of the site, used in links sent by
+		// email, e.g. "https://www.lenslocked.com".
+		BaseURL string
+		// TrustedProxies are the networks of the proxies in front of the
+		// server, whose X-Forwarded-For headers are trusted.
+		TrustedProxies []*net.IPNet
+	}
+	Images struct {
+		// SigningKey is used to sign image URLs so they can be loaded
+		// without a session.
+		SigningKey string
+	}
+	Trash struct {
+		// Retention is how long deleted galleries and images can be restored
+		// before they are purged.
+		Retention time.Duration
+	}
+	Comments struct {
+		// Key salts the hashes of the IP addresses of comment authors.
+		Key string
+	}
+	Analytics struct {
+		// Key salts the hashes of the IP addresses of visitors.
+		Key string
+	}
+	Robots struct {
+		// Disallow lists the paths crawlers are asked to skip, "/" keeping
+		// them off the whole site.
+		Disallow []string
 	}
 }
 
@@ -46,8 +77,44 @@ func Router(r *chi.Mux, umw controllers.UserMiddleware, cfg Config, db *sql.DB,
 	}
 
 	galleryService := &models.GalleryService{
+		DB:             db,
+		TrashRetention: cfg.Trash.Retention,
+	}
+	shareLinkService := &models.ShareLinkService{
+		DB: db,
+	}
+	memberService := &models.GalleryMemberService{
+		DB: db,
+	}
+	ownershipService := &models.OwnershipTransferService{
 		DB: db,
 	}
+	proofingService := &models.ProofingService{
+		DB: db,
+	}
+	commentService := &models.CommentService{
+		DB:  db,
+		Key: cfg.Comments.Key,
+	}
+	tagService := &models.TagService{
+		DB: db,
+	}
+	collectionService := &models.CollectionService{
+		DB: db,
+	}
+	watermarkService := &models.WatermarkService{
+		DB: db,
+	}
+	searchService := &models.SearchService{
+		DB: db,
+	}
+	embedService := &models.EmbedService{
+		DB: db,
+	}
+	analyticsService := &models.AnalyticsService{
+		DB:  db,
+		Key: cfg.Analytics.Key,
+	}
 
 	usersC.Templates.New = views.Must(
 		views.ParseFS(
@@ -117,7 +184,24 @@ func Router(r *chi.Mux, umw controllers.UserMiddleware, cfg Config, db *sql.DB,
 
 	// Add this where the other controllers are created
 	galleriesC := controllers.Galleries{
-		GalleryService: galleryService,
+		GalleryService:    galleryService,
+		UserService:       userService,
+		ShareLinkService:  shareLinkService,
+		MemberService:     memberService,
+		OwnershipService:  ownershipService,
+		ProofingService:   proofingService,
+		CommentService:    commentService,
+		TagService:        tagService,
+		CollectionService: collectionService,
+		SearchService:     searchService,
+		WatermarkService:  watermarkService,
+		EmbedService:      embedService,
+		AnalyticsService:  analyticsService,
+		EmailService:      emailService,
+		ImageURLs: controllers.ImageURLSigner{
+			Key: []byte(cfg.Images.SigningKey),
+		},
+		BaseURL: cfg.Server.BaseURL,
 	}
 
 	galleriesC.Templates.Show = views.Must(views.ParseFS(
@@ -140,24 +224,187 @@ func Router(r *chi.Mux, umw controllers.UserMiddleware, cfg Config, db *sql.DB,
 		JoinPath("layout", "layout.gohtml"),
 		JoinPath("pages", "galleries", "edit.gohtml"),
 	))
+	galleriesC.Templates.Profile = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "galleries", "profile.gohtml"),
+	))
+	galleriesC.Templates.Invitation = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "galleries", "invitation.gohtml"),
+	))
+	galleriesC.Templates.Transfer = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "galleries", "transfer.gohtml"),
+	))
+	galleriesC.Templates.Selections = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "galleries", "selections.gohtml"),
+	))
+	galleriesC.Templates.Comments = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "galleries", "comments.gohtml"),
+	))
+	galleriesC.Templates.Image = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "galleries", "image.gohtml"),
+	))
+	galleriesC.Templates.Duplicates = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "galleries", "duplicates.gohtml"),
+	))
+	galleriesC.Templates.Embed = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("pages", "galleries", "embed.gohtml"),
+	))
+	galleriesC.Templates.Search = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "galleries", "search.gohtml"),
+	))
+
+	collectionsC := controllers.Collections{
+		CollectionService: collectionService,
+	}
+	collectionsC.Templates.Index = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "collections", "index.gohtml"),
+	))
+
+	trashC := controllers.Trash{
+		GalleryService: galleryService,
+	}
+	trashC.Templates.Index = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "trash", "index.gohtml"),
+	))
+
+	watermarksC := controllers.Watermarks{
+		WatermarkService: watermarkService,
+	}
+	watermarksC.Templates.Edit = views.Must(views.ParseFS(
+		templates.FS,
+		JoinPath("layout", "layout.gohtml"),
+		JoinPath("pages", "watermark", "edit.gohtml"),
+	))
 
 	// galleries
 	r.Route("/galleries", func(r chi.Router) {
-		r.Get("/{id}", galleriesC.Show)
-		r.Get("/{id}/images/{filename}", galleriesC.Image)
+		r.Get("/{owner}/{id}", galleriesC.Show)
+		r.Get("/{owner}/{id}/images/{n:[0-9]+}", galleriesC.ShowImage)
+		r.Get("/{owner}/{id}/images/{imageID}", galleriesC.Image)
+		r.Get("/{owner}/{id}/download", galleriesC.Download)
+		r.Get("/{owner}/{id}/feed.atom", galleriesC.GalleryFeed)
+		r.Get("/{owner}/{id}/feed.rss", galleriesC.GalleryFeed)
+		r.Get("/{owner}/{id}/embed", galleriesC.Embed)
+		// Proofing
+		r.Post("/{owner}/{id}/proofing/picks/{imageID}", galleriesC.TogglePick)
+		r.Post("/{owner}/{id}/proofing/picks/{imageID}/note", galleriesC.SetPickNote)
+		r.Post("/{owner}/{id}/proofing/submit", galleriesC.SubmitSelection)
+		// Comments
+		r.Post("/{owner}/{id}/comments", galleriesC.CreateComment)
+		// Links from before galleries were found by their owner and slug,
+		// redirected to where the gallery is now
+		r.Get("/{owner}", galleriesC.Show)
+		r.Get("/{owner}/*", galleriesC.Show)
 		r.Group(func(r chi.Router) {
 			r.Use(umw.RequireUser)
 			r.Get("/", galleriesC.Index)
 			r.Get("/new", galleriesC.New)
 			r.Post("/", galleriesC.Create)
-			r.Get("/{id}/edit", galleriesC.Edit)
-			r.Post("/{id}", galleriesC.Update)
-			r.Post("/{id}/delete", galleriesC.Delete)
+			r.Get("/{owner}/{id}/edit", galleriesC.Edit)
+			r.Post("/{owner}/{id}", galleriesC.Update)
+			r.Post("/{owner}/{id}/delete", galleriesC.Delete)
+			r.Post("/{owner}/{id}/duplicate", galleriesC.Duplicate)
+			r.Post("/{owner}/{id}/merge", galleriesC.Merge)
 			// Images
-			r.Post("/{id}/images", galleriesC.UploadImage)
-			r.Post("/{id}/images/{filename}/delete", galleriesC.DeleteImage)
+			r.Post("/{owner}/{id}/images", galleriesC.UploadImage)
+			r.Post("/{owner}/{id}/images/order", galleriesC.ReorderImages)
+			r.Post("/{owner}/{id}/images/transfer", galleriesC.TransferImages)
+			r.Post("/{owner}/{id}/images/delete", galleriesC.DeleteImages)
+			r.Post("/{owner}/{id}/images/{imageID}", galleriesC.UpdateImage)
+			r.Post("/{owner}/{id}/images/{imageID}/delete", galleriesC.DeleteImage)
+			r.Post("/{owner}/{id}/images/{imageID}/edit", galleriesC.EditImage)
+			r.Post("/{owner}/{id}/images/{imageID}/revert", galleriesC.RevertImage)
+			r.Post("/{owner}/{id}/cover", galleriesC.SetCover)
+			r.Get("/{owner}/{id}/duplicates", galleriesC.Duplicates)
+			// Share links
+			r.Post("/{owner}/{id}/share-links", galleriesC.CreateShareLink)
+			r.Post("/{owner}/{id}/share-links/{linkID}/revoke", galleriesC.RevokeShareLink)
+			// Members
+			r.Post("/{owner}/{id}/members", galleriesC.InviteMember)
+			r.Post("/{owner}/{id}/members/{memberID}/delete", galleriesC.RemoveMember)
+			// Embedding
+			r.Post("/{owner}/{id}/embed", galleriesC.UpdateEmbed)
+			// Ownership transfer
+			r.Post("/{owner}/{id}/owner", galleriesC.TransferOwnership)
+			r.Post("/{owner}/{id}/owner/cancel", galleriesC.CancelOwnershipTransfer)
+			// Client selections
+			r.Get("/{owner}/{id}/proofing", galleriesC.Selections)
+			r.Get("/{owner}/{id}/proofing/{selectionID}/export.csv", galleriesC.ExportSelection)
+			// Comment moderation
+			r.Get("/{owner}/{id}/comments", galleriesC.Comments)
+			r.Post("/{owner}/{id}/comments/{commentID}", galleriesC.ModerateComment)
+			r.Post("/{owner}/{id}/comments/{commentID}/delete", galleriesC.DeleteComment)
 		})
 	})
+	// collections
+	r.Route("/collections", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/", collectionsC.Index)
+		r.Post("/", collectionsC.Create)
+		r.Post("/{id}", collectionsC.Update)
+		r.Post("/{id}/delete", collectionsC.Delete)
+	})
+	// trash
+	r.Route("/trash", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/", trashC.Index)
+		r.Post("/galleries/{id}/restore", trashC.RestoreGallery)
+		r.Post("/galleries/{id}/delete", trashC.PurgeGallery)
+		r.Post("/images/{id}/restore", trashC.RestoreImage)
+		r.Post("/images/{id}/delete", trashC.PurgeImage)
+	})
+	// watermark
+	r.Route("/watermark", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/", watermarksC.Edit)
+		r.Post("/", watermarksC.Update)
+		r.Get("/logo", watermarksC.Logo)
+		r.Post("/logo", watermarksC.UploadLogo)
+		r.Post("/logo/delete", watermarksC.RemoveLogo)
+	})
+	// search of public galleries
+	r.Get("/search", galleriesC.Search)
+	r.Get("/oembed", galleriesC.OEmbed)
+	r.Get("/sitemap.xml", galleriesC.SitemapIndex)
+	r.Get("/sitemap-galleries-{page}.xml", galleriesC.GalleriesSitemap)
+	r.Get("/sitemap-profiles-{page}.xml", galleriesC.ProfilesSitemap)
+	r.Get("/robots.txt", controllers.Robots(cfg.Server.BaseURL, cfg.Robots.Disallow))
+	// public profiles
+	r.Get("/profiles/{id}", galleriesC.Profile)
+	r.Get("/profiles/{id}/feed.atom", galleriesC.ProfileFeed)
+	r.Get("/profiles/{id}/feed.rss", galleriesC.ProfileFeed)
+	// gallery invitations
+	r.Route("/invitations", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/", galleriesC.Invitation)
+		r.Post("/", galleriesC.AcceptInvitation)
+	})
+	// gallery ownership transfers
+	r.Route("/transfers", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/", galleriesC.OwnershipTransfer)
+		r.Post("/", galleriesC.AcceptOwnershipTransfer)
+	})
 
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("404 Not Found: %s", r.URL.Path), http.StatusNotFound)
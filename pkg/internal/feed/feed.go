@@ -0,0 +1,256 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	atomNamespace  = "http://www.w3.org/2005/Atom"
+	mediaNamespace = "http://search.yahoo.com/mrss/"
+
+	// AtomContentType and RSSContentType are the media types of the feeds.
+	AtomContentType = "application/atom+xml; charset=utf-8"
+	RSSContentType  = "application/rss+xml; charset=utf-8"
+)
+
+// Feed is a list of entries that can be written as an Atom or an RSS feed.
+// Links must be absolute.
+type Feed struct {
+	// ID identifies the feed for good, e.g. the URL of the page it follows.
+	ID       string
+	Title    string
+	Subtitle string
+	// Link is the page the feed follows, and Self the URL of the feed.
+	Link string
+	Self string
+	// Updated is the last time the feed changed. It defaults to the latest
+	// update of its entries.
+	Updated   time.Time
+	Author    string
+	AuthorURI string
+	Entries   []Entry
+}
+
+// Entry is an item of a feed.
+type Entry struct {
+	// ID identifies the entry for good, e.g. a "urn:uuid:" URI.
+	ID        string
+	Title     string
+	Link      string
+	Summary   string
+	Published time.Time
+	Updated   time.Time
+	// Image is shown by readers as the thumbnail of the entry.
+	Image *Image
+}
+
+// Image is a picture attached to an entry.
+type Image struct {
+	URL string
+	// Type is the media type of the image, if known.
+	Type string
+	// Length is the size of the image in bytes, or 0 when unknown.
+	Length int64
+}
+
+// LastUpdated returns when the feed last changed, or the zero time when it
+// does not say and has no entries.
+func (f Feed) LastUpdated() time.Time {
+	updated := f.Updated
+	for _, entry := range f.Entries {
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+	}
+	return updated
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	Media    string      `xml:"xmlns:media,attr"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   atomPerson  `xml:"author"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string          `xml:"id"`
+	Title     string          `xml:"title"`
+	Links     []atomLink      `xml:"link"`
+	Summary   string          `xml:"summary,omitempty"`
+	Published string          `xml:"published,omitempty"`
+	Updated   string          `xml:"updated"`
+	Thumbnail *mediaThumbnail `xml:"media:thumbnail"`
+}
+
+type mediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// WriteAtom writes the feed in the Atom format.
+func (f Feed) WriteAtom(w io.Writer) error {
+	feed := atomFeed{
+		XMLNS:    atomNamespace,
+		Media:    mediaNamespace,
+		ID:       f.ID,
+		Title:    f.Title,
+		Subtitle: f.Subtitle,
+		Updated:  atomTime(f.LastUpdated()),
+		Links: []atomLink{
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+		},
+		Author: atomPerson{Name: f.Author, URI: f.AuthorURI},
+	}
+	for _, entry := range f.Entries {
+		item := atomEntry{
+			ID:      entry.ID,
+			Title:   entry.Title,
+			Links:   []atomLink{{Rel: "alternate", Type: "text/html", Href: entry.Link}},
+			Summary: entry.Summary,
+			Updated: atomTime(entry.Updated),
+		}
+		if !entry.Published.IsZero() {
+			item.Published = atomTime(entry.Published)
+		}
+		if entry.Image != nil {
+			item.Links = append(item.Links, atomLink{
+				Rel:    "enclosure",
+				Type:   entry.Image.Type,
+				Length: entry.Image.Length,
+				Href:   entry.Image.URL,
+			})
+			item.Thumbnail = &mediaThumbnail{URL: entry.Image.URL}
+		}
+		feed.Entries = append(feed.Entries, item)
+	}
+	return write(w, feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Media   string     `xml:"xmlns:media,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string          `xml:"title"`
+	Link        string          `xml:"link"`
+	GUID        rssGUID         `xml:"guid"`
+	Description string          `xml:"description,omitempty"`
+	PubDate     string          `xml:"pubDate"`
+	Enclosure   *rssEnclosure   `xml:"enclosure"`
+	Thumbnail   *mediaThumbnail `xml:"media:thumbnail"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func rssTime(t time.Time) string {
+	return t.UTC().Format(time.RFC1123Z)
+}
+
+// WriteRSS writes the feed in the RSS 2.0 format. Entries are dated by when
+// they were published, or else updated.
+func (f Feed) WriteRSS(w io.Writer) error {
+	description := f.Subtitle
+	if description == "" {
+		description = f.Title
+	}
+	feed := rssFeed{
+		Version: "2.0",
+		Atom:    atomNamespace,
+		Media:   mediaNamespace,
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   description,
+			LastBuildDate: rssTime(f.LastUpdated()),
+			Self:          atomLink{Rel: "self", Type: "application/rss+xml", Href: f.Self},
+		},
+	}
+	for _, entry := range f.Entries {
+		published := entry.Published
+		if published.IsZero() {
+			published = entry.Updated
+		}
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			GUID:        rssGUID{Value: entry.ID},
+			Description: entry.Summary,
+			PubDate:     rssTime(published),
+		}
+		if entry.Image != nil {
+			// RSS requires the type and length of enclosures, 0 standing for
+			// an unknown length.
+			if entry.Image.Type != "" {
+				item.Enclosure = &rssEnclosure{
+					URL:    entry.Image.URL,
+					Length: strconv.FormatInt(entry.Image.Length, 10),
+					Type:   entry.Image.Type,
+				}
+			}
+			item.Thumbnail = &mediaThumbnail{URL: entry.Image.URL}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return write(w, feed)
+}
+
+func write(w io.Writer, feed any) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(feed)
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
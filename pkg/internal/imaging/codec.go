@@ -0,0 +1,41 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// JPEGQuality is the quality used when re-encoding JPEG images.
+const JPEGQuality = 85
+
+// Decode reads an image and returns it together with its format name
+// ("jpeg", "png" or "gif").
+func Decode(r io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode: %w", err)
+	}
+	return img, format, nil
+}
+
+// Encode writes img using the given format. Unknown formats are written as
+// JPEG.
+func Encode(w io.Writer, img image.Image, format string) error {
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(w, img)
+	case "gif":
+		err = gif.Encode(w, img, nil)
+	default:
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: JPEGQuality})
+	}
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+// DHash returns the difference hash of img, a perceptual hash that barely
+// changes when the image is resized, recompressed or slightly altered. The
+// image is shrunk to 9x8 grey pixels, and every bit tells whether a pixel is
+// brighter than its right neighbour.
+func DHash(img image.Image) uint64 {
+	small := toRGBA(Resize(img, 9, 8))
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luminance(small, x, y) > luminance(small, x+1, y) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance returns the number of bits that differ between two hashes, from 0
+// for identical images to 64.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func luminance(img *image.RGBA, x, y int) int {
+	c := img.RGBAAt(img.Bounds().Min.X+x, img.Bounds().Min.Y+y)
+	// ITU-R BT.601 weights, scaled to integers.
+	return 299*int(c.R) + 587*int(c.G) + 114*int(c.B)
+}
@@ -0,0 +1,80 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// Rotate turns img clockwise by degrees, which must be 90, 180 or 270. Any
+// other angle returns img unchanged.
+func Rotate(img image.Image, degrees int) image.Image {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var dst *image.RGBA
+	switch degrees {
+	case 90, 270:
+		dst = image.NewRGBA(image.Rect(0, 0, height, width))
+	case 180:
+		dst = image.NewRGBA(image.Rect(0, 0, width, height))
+	default:
+		return img
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := src.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+			switch degrees {
+			case 90:
+				dst.SetRGBA(height-1-y, x, c)
+			case 180:
+				dst.SetRGBA(width-1-x, height-1-y, c)
+			case 270:
+				dst.SetRGBA(y, width-1-x, c)
+			}
+		}
+	}
+	return dst
+}
+
+// Flip mirrors img left to right when horizontal is set, or top to bottom
+// otherwise.
+func Flip(img image.Image, horizontal bool) image.Image {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := src.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+			if horizontal {
+				dst.SetRGBA(width-1-x, y, c)
+			} else {
+				dst.SetRGBA(x, height-1-y, c)
+			}
+		}
+	}
+	return dst
+}
+
+// Crop returns the part of img within r, relative to the top left corner of
+// img. r is clipped to the bounds of img.
+func Crop(img image.Image, r image.Rectangle) image.Image {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	r = r.Add(bounds.Min).Intersect(bounds)
+	if r.Empty() {
+		return img
+	}
+	return src.SubImage(r)
+}
+
+// Dimensions returns the width and height of the image in r, without
+// decoding all of it.
+func Dimensions(r io.Reader) (int, int, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("decode config: %w", err)
+	}
+	return config.Width, config.Height, nil
+}
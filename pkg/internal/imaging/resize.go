@@ -0,0 +1,82 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Fit scales img down so that it fits within maxWidth x maxHeight while
+// keeping its aspect ratio. Images that already fit are returned unchanged.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxWidth && height <= maxHeight {
+		return img
+	}
+	ratio := float64(maxWidth) / float64(width)
+	if r := float64(maxHeight) / float64(height); r < ratio {
+		ratio = r
+	}
+	newWidth := int(float64(width)*ratio + 0.5)
+	newHeight := int(float64(height)*ratio + 0.5)
+	if newWidth < 1 {
+		newWidth = 1
+	}
+	if newHeight < 1 {
+		newHeight = 1
+	}
+	return Resize(img, newWidth, newHeight)
+}
+
+// Resize scales img to exactly width x height. Every destination pixel is the
+// average of the source pixels it covers, which gives good results when
+// shrinking photos without pulling in an external imaging library.
+func Resize(img image.Image, width, height int) image.Image {
+	src := toRGBA(img)
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	scaleX := float64(bounds.Dx()) / float64(width)
+	scaleY := float64(bounds.Dy()) / float64(height)
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + int(float64(y)*scaleY)
+		y1 := bounds.Min.Y + int(float64(y+1)*scaleY)
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + int(float64(x)*scaleX)
+			x1 := bounds.Min.X + int(float64(x+1)*scaleX)
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			dst.SetRGBA(x, y, average(src, x0, y0, x1, y1))
+		}
+	}
+	return dst
+}
+
+func average(src *image.RGBA, x0, y0, x1, y1 int) color.RGBA {
+	var r, g, b, a, n uint32
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			c := src.RGBAAt(x, y)
+			r += uint32(c.R)
+			g += uint32(c.G)
+			b += uint32(c.B)
+			a += uint32(c.A)
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)}
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(bounds)
+	draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,106 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Position is where a watermark is drawn on an image.
+type Position string
+
+const (
+	TopLeft     Position = "top-left"
+	TopRight    Position = "top-right"
+	Center      Position = "center"
+	BottomLeft  Position = "bottom-left"
+	BottomRight Position = "bottom-right"
+	// Tile repeats the watermark over the whole image, which makes it much
+	// harder to crop out.
+	Tile Position = "tile"
+)
+
+// Watermark draws mark over img at pos. The mark is scaled so that its width
+// is scale times the width of img, and drawn with the given opacity, both
+// between 0 and 1. img is left untouched.
+func Watermark(img, mark image.Image, pos Position, scale, opacity float64) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	markBounds := mark.Bounds()
+	width := int(float64(bounds.Dx())*scale + 0.5)
+	if width < 1 || markBounds.Dx() < 1 {
+		return dst
+	}
+	height := markBounds.Dy() * width / markBounds.Dx()
+	if height < 1 {
+		return dst
+	}
+	mark = Resize(mark, width, height)
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity*255 + 0.5)})
+	margin := min(bounds.Dx(), bounds.Dy()) / 50
+	for _, pt := range placements(dst.Bounds(), width, height, margin, pos) {
+		r := image.Rect(pt.X, pt.Y, pt.X+width, pt.Y+height)
+		draw.DrawMask(dst, r, mark, image.Point{}, mask, image.Point{}, draw.Over)
+	}
+	return dst
+}
+
+// placements returns the top left corners where a width x height mark is
+// drawn within bounds.
+func placements(bounds image.Rectangle, width, height, margin int, pos Position) []image.Point {
+	left, top := margin, margin
+	right := bounds.Dx() - width - margin
+	bottom := bounds.Dy() - height - margin
+	switch pos {
+	case TopLeft:
+		return []image.Point{{left, top}}
+	case TopRight:
+		return []image.Point{{right, top}}
+	case BottomLeft:
+		return []image.Point{{left, bottom}}
+	case Center:
+		return []image.Point{{(bounds.Dx() - width) / 2, (bounds.Dy() - height) / 2}}
+	case Tile:
+		// Every other row is shifted by half a mark so the marks do not line
+		// up in columns.
+		var points []image.Point
+		stepX, stepY := width+width/2, height*3
+		for row, y := 0, margin; y < bounds.Dy(); row, y = row+1, y+stepY {
+			x := margin
+			if row%2 == 1 {
+				x -= stepX / 2
+			}
+			for ; x < bounds.Dx(); x += stepX {
+				points = append(points, image.Point{x, y})
+			}
+		}
+		return points
+	}
+	return []image.Point{{right, bottom}}
+}
+
+// Text renders text in white, with a dark shadow so it reads on light and
+// dark photos alike, on a transparent background. It is meant to be scaled
+// up by Watermark.
+func Text(text string) image.Image {
+	face := basicfont.Face7x13
+	drawer := font.Drawer{Face: face}
+	width := drawer.MeasureString(text).Ceil()
+	metrics := face.Metrics()
+	height := metrics.Height.Ceil()
+	img := image.NewRGBA(image.Rect(0, 0, width+1, height+1))
+	drawer.Dst = img
+	drawer.Src = image.NewUniform(color.RGBA{A: 160})
+	drawer.Dot = fixed.P(1, metrics.Ascent.Ceil()+1)
+	drawer.DrawString(text)
+	drawer.Src = image.White
+	drawer.Dot = fixed.P(0, metrics.Ascent.Ceil())
+	drawer.DrawString(text)
+	return img
+}
@@ -0,0 +1,112 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const (
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	imageNamespace   = "http://www.google.com/schemas/sitemap-image/1.1"
+
+	// ContentType is the media type of sitemaps.
+	ContentType = "application/xml; charset=utf-8"
+
+	// MaxURLs and MaxImages are the number of pages a sitemap, or of
+	// sitemaps an index, and the number of images a page can list.
+	MaxURLs   = 50000
+	MaxImages = 1000
+)
+
+// Sitemap lists the pages of a site search engines should crawl. Links must
+// be absolute.
+type Sitemap struct {
+	URLs []URL
+}
+
+// URL is a page of a sitemap.
+type URL struct {
+	Loc string
+	// LastMod is when the page last changed, if known.
+	LastMod time.Time
+	// Images are the URLs of the images shown on the page.
+	Images []string
+}
+
+// Index lists the sitemaps of a site that has more pages than a sitemap can
+// hold. Links must be absolute.
+type Index struct {
+	Sitemaps []string
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name  `xml:"sitemapindex"`
+	XMLNS    string    `xml:"xmlns,attr"`
+	Sitemaps []sitemap `xml:"sitemap"`
+}
+
+type sitemap struct {
+	Loc string `xml:"loc"`
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Image   string   `xml:"xmlns:image,attr"`
+	URLs    []url    `xml:"url"`
+}
+
+type url struct {
+	Loc     string  `xml:"loc"`
+	LastMod string  `xml:"lastmod,omitempty"`
+	Images  []image `xml:"image:image"`
+}
+
+type image struct {
+	Loc string `xml:"image:loc"`
+}
+
+// Write writes the sitemap in the sitemaps.org format, with the images of
+// each page. Pages and images past MaxURLs and MaxImages are left out.
+func (s Sitemap) Write(w io.Writer) error {
+	set := urlSet{
+		XMLNS: sitemapNamespace,
+		Image: imageNamespace,
+	}
+	for _, u := range s.URLs[:min(len(s.URLs), MaxURLs)] {
+		item := url{Loc: u.Loc}
+		if !u.LastMod.IsZero() {
+			item.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+		}
+		for _, loc := range u.Images[:min(len(u.Images), MaxImages)] {
+			item.Images = append(item.Images, image{Loc: loc})
+		}
+		set.URLs = append(set.URLs, item)
+	}
+	return writeXML(w, set)
+}
+
+// Write writes the index in the sitemaps.org format. Sitemaps past MaxURLs
+// are left out.
+func (index Index) Write(w io.Writer) error {
+	set := sitemapIndex{XMLNS: sitemapNamespace}
+	for _, loc := range index.Sitemaps[:min(len(index.Sitemaps), MaxURLs)] {
+		set.Sitemaps = append(set.Sitemaps, sitemap{Loc: loc})
+	}
+	return writeXML(w, set)
+}
+
+func writeXML(w io.Writer, v any) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(v)
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}